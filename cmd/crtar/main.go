@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/asc-ac-at/sam/internal/crtar"
 )
@@ -16,13 +17,16 @@ import (
 // args
 var defaultSWSVersion = "2023.06"
 var eessiVersionPtr = flag.String("EESSI-version", defaultSWSVersion, "Version of the (EEESI based) software stack")
-var defaultCpuArchSubdir = "x86_64/amd/zen4"
-var cpuArchSubdirPtr = flag.String("cpuArchSubdir", defaultCpuArchSubdir, "CPU Arch subdirectory to search")
+var cpuArchSubdirPtr = flag.String("cpuArchSubdir", crtar.DefaultCpuArchSubdir, "CPU Arch subdirectory to search")
 var defaultName = "unnamed"
 var namePtr = flag.String("name", defaultName, "Name of the tarball being created")
 var outputDirPtr = flag.String("outputDir", "/opt/adm/sw-archives", "Output directory to save tarball")
 var defaultRepo = "software.asc.ac.at"
 var repoPtr = flag.String("repo", defaultRepo, "CVMFS repository for which the software was built")
+var pathsPtr = flag.String("paths", "", "Comma separated paths or globs below overlay-upper/ to archive instead of software/linux/<cpuArchSubdir>, the cpuArchSubdir defaults to generic")
+var allowReplacePtr = flag.String("allow-replace", "", "Reason for replacing already published installations (recorded in the manifest)")
+var skipReplaceCheckPtr = flag.String("skip-replace-check", "", "Reason for archiving without checking for replacements of published installations, e.g. outside of a samctr session (recorded in the manifest)")
+var sbomFlag = flag.Bool("sbom", true, "Write a CycloneDX sbom of the archived software dirs next to the tarball")
 var versionFlag = flag.Bool("version", false, "print version info")
 
 var Version = "unknown"
@@ -31,19 +35,116 @@ func printVersion() {
 	fmt.Printf("crtar version: %s\n", Version)
 }
 
+// splitCommaList splits a comma-separated list while trimming whitespace and ignoring empty parts.
+func splitCommaList(s string) []string {
+	out := []string{}
+	for _, p := range strings.Split(s, ",") {
+		if t := strings.TrimSpace(p); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// flagSet reports whether the flag name was given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "watch":
+			watchMain(os.Args[2:])
+			return
+		case "prune":
+			pruneMain(os.Args[2:])
+			return
+		}
+	}
 	flag.Parse()
 	if *versionFlag {
 		printVersion()
 		return
 	}
-	listFile, err := crtar.MakeListFile(*repoPtr, *eessiVersionPtr, *cpuArchSubdirPtr)
+	var fileList []string
+	var replacements []crtar.Replacement
+	var companions []crtar.Companion
+	paths := splitCommaList(*pathsPtr)
+	if len(paths) > 0 && !flagSet("cpuArchSubdir") {
+		*cpuArchSubdirPtr = crtar.GenericCpuArchSubdir
+	}
+	if len(paths) > 0 {
+		files, err := crtar.SubtreeEntries(*repoPtr, paths)
+		if err != nil {
+			log.Printf("error collecting files: %s, exiting", err)
+			os.Exit(1)
+		}
+		if *skipReplaceCheckPtr == "" {
+			replacements, err = crtar.FindFileReplacements(*repoPtr, files)
+			if err != nil {
+				log.Printf("error checking for replacements: %s, use -skip-replace-check <reason> to archive without the check, exiting", err)
+				os.Exit(1)
+			}
+		}
+		fileList = files
+	} else {
+		modules, software, err := crtar.ArchDirEntries(*repoPtr, *eessiVersionPtr, *cpuArchSubdirPtr)
+		if err != nil {
+			log.Printf("error collecting files: %s, exiting", err)
+			os.Exit(1)
+		}
+		if *skipReplaceCheckPtr == "" {
+			replacements, err = crtar.FindReplacements(*repoPtr, modules, software)
+			if err != nil {
+				log.Printf("error checking for replacements: %s, use -skip-replace-check <reason> to archive without the check, exiting", err)
+				os.Exit(1)
+			}
+		}
+		fileList = append(modules, software...)
+		if *sbomFlag {
+			companions = append(companions, &crtar.SBOM{ToolVersion: Version, SoftwareDirs: software})
+		}
+	}
+	if len(fileList) == 0 {
+		log.Printf("nothing to archive, exiting")
+		os.Exit(1)
+	}
+	if len(replacements) > 0 && *allowReplacePtr == "" {
+		log.Printf("%d replacement(s) of published installations found, use -allow-replace <reason> to archive anyway, exiting", len(replacements))
+		os.Exit(1)
+	}
+
+	listFile, err := crtar.MakeListFile(*repoPtr, fileList)
 	if err != nil {
 		log.Printf("error making listfile: %s, exiting", err)
 		os.Exit(1)
 	}
 
-	_, execErr := crtar.ExecTar(*repoPtr, *cpuArchSubdirPtr, *namePtr, *outputDirPtr, listFile)
+	manifest := &crtar.Manifest{
+		Repo:          *repoPtr,
+		Version:       *eessiVersionPtr,
+		CpuArchSubdir: *cpuArchSubdirPtr,
+		Files:         fileList,
+		Paths:         paths,
+		Replacements:  replacements,
+	}
+	if len(replacements) > 0 {
+		manifest.ReplaceReason = *allowReplacePtr
+	}
+	if *skipReplaceCheckPtr != "" {
+		log.Printf("warning: not checked for replacements of published installations: %s", *skipReplaceCheckPtr)
+		manifest.ReplaceCheckSkipped = *skipReplaceCheckPtr
+	}
+	companions = append([]crtar.Companion{manifest}, companions...)
+
+	_, execErr := crtar.ExecTar(*repoPtr, *cpuArchSubdirPtr, *namePtr, *outputDirPtr, listFile, companions...)
 	if execErr != nil {
 		log.Fatalf("execTar failed %s\n", execErr)
 	}
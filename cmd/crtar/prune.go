@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/asc-ac-at/sam/internal/crtar"
+)
+
+// crtar prune [flags] <dir>
+func pruneMain(args []string) {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	keep := fs.Int("keep", 3, "Number of ingested tarballs to keep per package and arch")
+	keepDays := fs.Int("keep-days", 30, "Keep every tarball younger than this many days")
+	failedDays := fs.Int("failed-days", 90, "Remove tarballs in failed/ older than this many days, 0 keeps them")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be removed")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: crtar prune [flags] <dir>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := crtar.PruneOptions{
+		Dir:        fs.Arg(0),
+		Keep:       *keep,
+		KeepDays:   *keepDays,
+		FailedDays: *failedDays,
+		DryRun:     *dryRun,
+	}
+	result, err := crtar.Prune(opts)
+	if err != nil {
+		log.Fatalf("prune %s failed: %s\n", opts.Dir, err)
+	}
+
+	action := "removed"
+	if opts.DryRun {
+		action = "would remove"
+	}
+	for _, p := range result.Removed {
+		fmt.Printf("%s %s\n", action, p)
+	}
+	fmt.Printf("%d tarball(s) %s, %d kept, %s reclaimed\n",
+		len(result.Removed), action, len(result.Kept), humanSize(result.Reclaimed))
+}
+
+func humanSize(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
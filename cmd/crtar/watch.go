@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/crtar"
+)
+
+// crtar watch [flags] <dir>
+func watchMain(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	ingestCmd := fs.String("ingest-cmd", "", "Ingestion command, the tarball path is appended as last argument")
+	verifyCmd := fs.String("verify-cmd", "gpg --verify", "Command to verify <tarball>.sig, called with the signature and tarball as arguments")
+	interval := fs.Duration("interval", time.Minute, "Time between two scans of the output directory")
+	once := fs.Bool("once", false, "Process the completed tarballs once and exit")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: crtar watch [flags] <dir>\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	opts := crtar.WatchOptions{
+		Dir:       fs.Arg(0),
+		IngestCmd: strings.Fields(*ingestCmd),
+		VerifyCmd: strings.Fields(*verifyCmd),
+		Interval:  *interval,
+		Once:      *once,
+	}
+	if err := crtar.Watch(opts); err != nil {
+		log.Fatalf("watch %s failed: %s\n", opts.Dir, err)
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+var pipelineFlag = flag.String("pipeline", "", "pipeline of the config submitted by samgx chain")
+
+// chainStages returns the stages given as arguments or the pipeline selected
+// with -pipeline
+func chainStages(config *samgx.Config, args []string) (string, []samgx.Stage, error) {
+	if *pipelineFlag != "" {
+		if len(args) > 0 {
+			return "", nil, fmt.Errorf("chain takes either -pipeline or stages")
+		}
+		stages, ok := config.Pipelines[*pipelineFlag]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown pipeline %q", *pipelineFlag)
+		}
+		return *pipelineFlag, stages, nil
+	}
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("chain requires -pipeline or <toolchain>[:<after>,...] arguments")
+	}
+	var stages []samgx.Stage
+	for _, a := range args {
+		s, err := samgx.ParseStage(a)
+		if err != nil {
+			return "", nil, err
+		}
+		stages = append(stages, s)
+	}
+	return "chain", stages, nil
+}
+
+// stageOpts returns a copy of opts with the values of the stage applied
+func stageOpts(opts map[string]*string, s samgx.Stage) map[string]*string {
+	result := copyOpts(opts)
+	*result["toolchain"] = s.Toolchain
+	if s.Name != "" {
+		*result["name"] = s.Name
+	}
+	if s.Recipe != "" {
+		*result["recipe"] = s.Recipe
+	}
+	if s.EbVer != "" {
+		*result["ebver"] = s.EbVer
+	}
+	return result
+}
+
+// samgx chain submits the stages in dependency order, each job waits for the
+// jobs of the stages it depends on and is cancelled by slurm if one fails.
+// All jobs are recorded under one chain name.
+func submitChain(lib *samgx.Library, opts map[string]*string, config *samgx.Config, args []string) error {
+	name, stages, err := chainStages(config, args)
+	if err != nil {
+		return err
+	}
+	stages, err = samgx.OrderStages(stages)
+	if err != nil {
+		return err
+	}
+	// render everything before submitting anything
+	builds := make([]*build, len(stages))
+	for i, s := range stages {
+		builds[i], err = renderBuild(lib, stageOpts(opts, s), config)
+		if err != nil {
+			return fmt.Errorf("stage %s: %w", s.Key(), err)
+		}
+	}
+	state, err := samgx.LoadJobState(config.StatePath())
+	if err != nil {
+		return err
+	}
+	chain := fmt.Sprintf("%s-%s", name, time.Now().Format("20060102150405"))
+	ids := make(map[string]string)
+	for i, s := range stages {
+		job := samgx.SubmittedJob{Chain: chain}
+		for _, a := range s.After {
+			job.After = append(job.After, ids[a])
+		}
+		job, err = submitBuild(lib, config, state, builds[i], job)
+		if job.JobID != "" {
+			// submitted, possibly without being recorded
+			ids[s.Key()] = job.JobID
+			fmt.Printf("%s\t%s\n", s.Key(), job.JobID)
+		}
+		if err != nil {
+			return fmt.Errorf("stage %s: %w%s", s.Key(), err, partialChain(chain, stages, ids))
+		}
+	}
+	log.Printf("submitted chain %s with %d jobs", chain, len(stages))
+	return nil
+}
+
+// partialChain describes a chain whose submission stopped: the stages
+// submitted (with their job ids) and those that were not
+func partialChain(chain string, stages []samgx.Stage, ids map[string]string) string {
+	if len(ids) == 0 {
+		return ""
+	}
+	var submitted, missing, jobIDs []string
+	for _, s := range stages {
+		if id, ok := ids[s.Key()]; ok {
+			submitted = append(submitted, fmt.Sprintf("%s (%s)", s.Key(), id))
+			jobIDs = append(jobIDs, id)
+		} else {
+			missing = append(missing, s.Key())
+		}
+	}
+	return fmt.Sprintf("\nchain %s is incomplete\n  submitted: %s\n  not submitted: %s\ncancel the submitted jobs with: scancel %s",
+		chain, strings.Join(submitted, ", "), strings.Join(missing, ", "), strings.Join(jobIDs, " "))
+}
@@ -0,0 +1,209 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+// checkEasystack parses the easystack selected by the options and looks up
+// its easyconfigs. Missing easyconfigs are an error unless
+// -allow-missing-easyconfigs is given.
+func checkEasystack(opts map[string]*string, config *samgx.Config) (*samgx.Easystack, []samgx.ResolvedEasyconfig, error) {
+	p := samgx.EasystackPath(*opts["gitrepo"], *opts["stackver"], *opts["ebver"], *opts["toolchain"])
+	es, err := samgx.ReadEasystack(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolveEasystack(es, opts, config)
+}
+
+// checkStack checks -stackver, -toolchain and -ebver against the easystacks
+// of the git repo. A toolchain missing from the repo is also looked up in the
+// toolchains of the installed EasyBuild, if there is one.
+func checkStack(opts map[string]*string, config *samgx.Config) error {
+	stacks, err := samgx.DiscoverStacks(*opts["gitrepo"])
+	if err != nil {
+		// reported when the easystack is read
+		return nil
+	}
+	toolchain := *opts["toolchain"]
+	err = samgx.CheckStack(stacks, *opts["stackver"], *opts["ebver"], toolchain)
+	ebToolchains := easyBuildToolchains(config)
+	if ebToolchains == nil {
+		return err
+	}
+	if tcErr := samgx.CheckToolchainName(toolchain, ebToolchains); tcErr != nil {
+		if err != nil {
+			return fmt.Errorf("%w; %w", err, tcErr)
+		}
+		log.Printf("warning: %s", tcErr)
+	}
+	return err
+}
+
+// toolchains of the eb_command of the config, nil if there is no EasyBuild
+var ebToolchains struct {
+	done bool
+	list []string
+}
+
+func easyBuildToolchains(config *samgx.Config) []string {
+	if ebToolchains.done {
+		return ebToolchains.list
+	}
+	ebToolchains.done = true
+	eb := strings.Fields(config.EbCommand)
+	if len(eb) == 0 {
+		return nil
+	}
+	if _, err := exec.LookPath(eb[0]); err != nil {
+		log.Printf("not checking -toolchain against EasyBuild: %s", err)
+		return nil
+	}
+	list, err := samgx.EasyBuildToolchains(eb)
+	if err != nil {
+		log.Printf("not checking -toolchain against EasyBuild: %s", err)
+		return nil
+	}
+	ebToolchains.list = list
+	return list
+}
+
+var allowMissingFlag = flag.Bool("allow-missing-easyconfigs", false, "only warn about easyconfigs of the easystack not found in the git repo or robot paths")
+
+// resolveEasystack looks up the easyconfigs of es, see checkEasystack. If the
+// config, its easybuild section and the environment name no robot paths,
+// those of EasyBuild are used.
+func resolveEasystack(es *samgx.Easystack, opts map[string]*string, config *samgx.Config) (*samgx.Easystack, []samgx.ResolvedEasyconfig, error) {
+	robotPaths, err := config.SearchRobotPaths(*opts["stackver"], *opts["toolchain"])
+	if err != nil {
+		return es, nil, err
+	}
+	var ebErr error
+	if len(robotPaths) == 0 {
+		robotPaths, ebErr = easyBuildRobotPaths(config)
+	}
+	resolved, err := es.Resolve(*opts["gitrepo"], robotPaths)
+	if !errors.Is(err, samgx.ErrEasyconfigsMissing) {
+		return es, resolved, err
+	}
+	if ebErr != nil {
+		err = fmt.Errorf("%w (EasyBuild's robot path not searched: %s, set robot_paths in the config)", err, ebErr)
+	}
+	if *allowMissingFlag {
+		log.Printf("warning: %s", err)
+		err = nil
+	}
+	return es, resolved, err
+}
+
+// robot paths of the eb_command of the config
+var ebRobotPaths struct {
+	done bool
+	list []string
+	err  error
+}
+
+func easyBuildRobotPaths(config *samgx.Config) ([]string, error) {
+	if !ebRobotPaths.done {
+		ebRobotPaths.done = true
+		ebRobotPaths.list, ebRobotPaths.err = samgx.EasyBuildRobotPaths(strings.Fields(config.EbCommand))
+	}
+	return ebRobotPaths.list, ebRobotPaths.err
+}
+
+var missingOnlyFlag = flag.Bool("missing-only", false, "only build the easyconfigs of the easystack whose modules are not in the install dir yet")
+
+// missingArch returns the arch checked by -missing-only, the -arch or
+// $EESSI_SOFTWARE_SUBDIR
+func missingArch(opts map[string]*string) string {
+	if arch := *opts["arch"]; arch != "" {
+		return arch
+	}
+	return os.Getenv("EESSI_SOFTWARE_SUBDIR")
+}
+
+// missingEasystack returns the part of the easystack that is not installed in
+// the install dir for arch yet and prints a table of the installed and
+// missing easyconfigs to stderr
+func missingEasystack(opts map[string]*string, config *samgx.Config, es *samgx.Easystack, resolved []samgx.ResolvedEasyconfig, arch string) (string, error) {
+	if arch == "" {
+		return "", fmt.Errorf("-missing-only requires -arch or $EESSI_SOFTWARE_SUBDIR")
+	}
+	modulesDir := samgx.ModulesDir(config.InstallDir, *opts["stackver"], arch)
+	statuses, err := samgx.InstallStatuses(resolved, modulesDir)
+	if err != nil {
+		return "", err
+	}
+	missing := make(map[string]bool)
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EASYCONFIG\tMODULE\tSTATUS")
+	for _, s := range statuses {
+		status := "installed"
+		if !s.Installed {
+			status = "missing"
+			missing[s.Easyconfig] = true
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Easyconfig, s.Module, status)
+	}
+	w.Flush()
+	if len(missing) == 0 {
+		return "", fmt.Errorf("all %d easyconfigs of %s are installed in %s", len(statuses), es.Path, modulesDir)
+	}
+	log.Printf("%d of %d easyconfigs missing from %s", len(missing), len(statuses), modulesDir)
+	data, err := es.Filter(func(e samgx.EasystackEntry) bool { return missing[e.Easyconfig] }).Marshal()
+	return string(data), err
+}
+
+func logEasyconfigs(es *samgx.Easystack, resolved []samgx.ResolvedEasyconfig) {
+	log.Printf("easystack %s: %d easyconfigs", es.Path, len(resolved))
+	for _, r := range resolved {
+		log.Printf("  %s (%s)", r.Easyconfig, sourceString(r))
+	}
+}
+
+func sourceString(r samgx.ResolvedEasyconfig) string {
+	switch r.Source {
+	case "":
+		return "not found"
+	case samgx.SourcePR:
+		return fmt.Sprintf("%s %s", r.Source, r.Path)
+	default:
+		return r.Path
+	}
+}
+
+// samgx easystack
+func listEasystack(opts map[string]*string, config *samgx.Config) error {
+	defaultEbVer(opts)
+	if err := checkStack(opts, config); err != nil {
+		return err
+	}
+	_, resolved, err := checkEasystack(opts, config)
+	if resolved == nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EASYCONFIG\tSOURCE\tLOCATION")
+	for _, r := range resolved {
+		source, location := r.Source, r.Path
+		if source == "" {
+			source, location = "-", "not found"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Easyconfig, source, location)
+	}
+	w.Flush()
+	return err
+}
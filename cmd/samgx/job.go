@@ -0,0 +1,69 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+// slurm and samctr options of -format sbatch, empty values are taken from the
+// matrix (with -arch), slurm and samctr sections of the config
+var (
+	jobNameFlag        = flag.String("job-name", "", "slurm job name (default <name>-<toolchain>)")
+	partitionFlag      = flag.String("partition", "", "slurm partition")
+	memFlag            = flag.String("mem", "", "memory of the slurm job, e.g. 64G")
+	timeFlag           = flag.String("time", "", "time limit of the slurm job, e.g. 24:00:00")
+	cpusFlag           = flag.String("cpus", "", "cpus per task of the slurm job")
+	samctrConfigFlag   = flag.String("samctr-config", "", "config file passed to samctr")
+	writeableReposFlag = flag.String("writeable-repos", "", "comma separated repositories samctr mounts writeable")
+	resumeFlag         = flag.String("resume", "", "samctr resume path")
+)
+
+// x86_64/amd/zen4 -> x86_64-amd-zen4
+func archName(cpuArchSubdir string) string {
+	return strings.ReplaceAll(cpuArchSubdir, "/", "-")
+}
+
+// the data to wrap the rendered build command into a slurm job script
+func jobData(config *samgx.Config, b *build) samgx.JobData {
+	data := b.data
+	opts := config.JobOptions(data.Toolchain)
+	if data.CpuArchSubdir != "" {
+		opts = opts.Merge(config.Matrix[data.CpuArchSubdir].JobOptions)
+	}
+	opts = opts.Merge(samgx.JobOptions{
+		Partition: *partitionFlag,
+		Mem:       *memFlag,
+		Time:      *timeFlag,
+		Cpus:      *cpusFlag,
+	})
+	job := samgx.JobData{
+		JobOptions:     opts,
+		JobName:        *jobNameFlag,
+		SamctrConfig:   config.Samctr.Config,
+		WriteableRepos: strings.Join(config.Samctr.WriteableRepos, ","),
+		Resume:         config.Samctr.Resume,
+		BuildCmd:       strings.TrimSpace(b.cmd),
+	}
+	if job.JobName == "" {
+		job.JobName = strings.Trim(data.Name+"-"+data.Toolchain, "-")
+		if data.CpuArchSubdir != "" {
+			job.JobName += "-" + archName(data.CpuArchSubdir)
+		}
+	}
+	if *samctrConfigFlag != "" {
+		job.SamctrConfig = *samctrConfigFlag
+	}
+	if *writeableReposFlag != "" {
+		job.WriteableRepos = *writeableReposFlag
+	}
+	if *resumeFlag != "" {
+		job.Resume = *resumeFlag
+	}
+	return job
+}
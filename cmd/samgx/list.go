@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+// defaultEbVer sets -ebver to the easybuild version the git repo uses for the
+// chosen stack (and toolchain) if neither the flag nor the config set it
+func defaultEbVer(opts map[string]*string) {
+	if *opts["ebver"] != "" || *opts["gitrepo"] == "" {
+		return
+	}
+	stacks, err := samgx.DiscoverStacks(*opts["gitrepo"])
+	if err != nil {
+		log.Printf("cannot compute default ebver: %s", err)
+		return
+	}
+	if v := samgx.DefaultEbVer(stacks, *opts["stackver"], *opts["toolchain"]); v != "" {
+		log.Printf("Using ebver %s from %s", v, *opts["gitrepo"])
+		*opts["ebver"] = v
+	}
+}
+
+// samgx list
+func listStacks(opts map[string]*string) error {
+	if *opts["gitrepo"] == "" {
+		return fmt.Errorf("list requires -gitrepo")
+	}
+	stacks, err := samgx.DiscoverStacks(*opts["gitrepo"])
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STACK\tEBVER\tTOOLCHAINS")
+	for i := 0; i < len(stacks); {
+		s := stacks[i]
+		var toolchains []string
+		for ; i < len(stacks) && stacks[i].StackVer == s.StackVer && stacks[i].EbVer == s.EbVer; i++ {
+			toolchains = append(toolchains, stacks[i].Toolchain)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.StackVer, s.EbVer, strings.Join(toolchains, ","))
+	}
+	w.Flush()
+	return nil
+}
@@ -5,11 +5,15 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
-	"html/template"
 	"log"
 	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
 )
 
 // args
@@ -19,10 +23,14 @@ func initDefaults() map[string]string {
 	defaults["stackver"] = "2025.06"
 	defaults["name"] = ""
 	defaults["toolchain"] = ""
-	// only true as of v2025.06 in February 2026 ... this should be computed
-	defaults["ebver"] = "5.2.0"
+	// computed from the easystacks in the git repo, see defaultEbVer
+	defaults["ebver"] = ""
 	defaults["gitrepo"] = ""
 	defaults["ebopts"] = ""
+	defaults["easyconfig"] = ""
+	defaults["recipe"] = samgx.DefaultRecipe
+	defaults["arch"] = ""
+	defaults["target"] = ""
 	return defaults
 }
 
@@ -32,41 +40,45 @@ func initOpts() map[string]*string {
 	opts["stackver"] = flag.String("stackver", defaults["stackver"], "Version of the software stack release")
 	opts["name"] = flag.String("name", defaults["name"], "Name of the software package being build")
 	opts["toolchain"] = flag.String("toolchain", defaults["toolchain"], "easybuild toolchain being used to build the software")
-	opts["ebver"] = flag.String("ebver", defaults["ebver"], "easybuild version being used to build")
+	opts["ebver"] = flag.String("ebver", defaults["ebver"], "easybuild version being used to build (default: the one the git repo uses for the stack)")
 	opts["gitrepo"] = flag.String("gitrepo", defaults["gitrepo"], "path to the checked out git repo containing easystack")
-	opts["ebopts"] = flag.String("ebopts", defaults["ebopts"], "any extra options to pass to easybuild")
+	opts["ebopts"] = flag.String("ebopts", defaults["ebopts"], "any extra options to pass to easybuild, split into arguments like the shell does")
+	opts["easyconfig"] = flag.String("easyconfig", defaults["easyconfig"], "easyconfig used by the single easyconfig recipes")
+	opts["recipe"] = flag.String("recipe", defaults["recipe"], "build recipe (see samgx recipes)")
+	opts["arch"] = flag.String("arch", defaults["arch"], "cpuArchSubdir of the matrix in the config to build for")
+	opts["target"] = flag.String("target", defaults["target"], "install target of the config (default: the top level install_dir, lmod_init, ...)")
 	flag.Parse()
 	return opts
 }
 
-// eventually this would come from a file ?
-func initConfig() map[string]string {
-	config := make(map[string]string)
-	config["lmodInit"] = "/opt/adm/asc-software-stack/asc-software-layer-scripts/init/lmod/bash"
-	config["installDir"] = "/cvmfs/software.eessi.io"
-	config["buildCmdTmpl"] = `
-#!/usr/bin/env bash
-
-stack_file="{{ .GitRepo }}/easystacks/{{ .StackVer }}/asc_eb_{{ .EbVer }}-{{ .Toolchain }}.yaml"
-if [ ! -f ${stack_file} ]; then
-    printf "ERR - file not found ${stack_file}"
-    exit 1
-fi
-
-source {{ .LmodInit }}
-export EESSI_PROJECT_INSTALL={{ .InstallDir }}
-TS=$(date +%y%m%d%M%S)
-
-ml --force purge
-ml load "EESSI/{{ .StackVer }}" "ASC/{{ .StackVer }}" \
-    && ml load EESSI-extend || printf "ERR - module not found EESSI/{{ .StackVer }} ASC/{{ .StackVer }}\n"
-
-eb -r --easystack ${stack_file} "{{ .EbOpts }}" \
-    && crtar -EESSI-version '{{ .StackVer }}' -name "{{ .Name }}-{{ .Toolchain }}-${TS}"
-`
-	return config
+var configFlag = flag.String("config", "", "config file (default $XDG_CONFIG_HOME/samgx/config.yaml)")
+
+// Options not given on the command line are taken from the config file,
+// precedence (highest first) is: flag, stack section, defaults section,
+// built in default. An unset ebver is computed from the git repo when the
+// build command is rendered, see defaultEbVer.
+func applyConfigDefaults(opts map[string]*string, config *samgx.Config) error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if v, ok := config.Defaults["stackver"]; ok && !set["stackver"] {
+		*opts["stackver"] = v
+	}
+	for k, v := range config.OptDefaults(*opts["stackver"]) {
+		opt, ok := opts[k]
+		if !ok {
+			return fmt.Errorf("configuration error: unknown option %q in %s", k, config.Path)
+		}
+		if !set[k] {
+			*opt = v
+		}
+	}
+	return nil
 }
 
+var formatFlag = flag.String("format", "bash", "output format: bash (build command), sbatch (slurm job script wrapping samctr exec) or json (build plan)")
+
 var Version = "unknown"
 var versionFlag = flag.Bool("version", false, "print version info")
 
@@ -74,35 +86,218 @@ func printVersion() {
 	fmt.Printf("samgx version: %s\n", Version)
 }
 
-type BuildCmdData struct {
-	StackVer, Name, Toolchain, EbVer, GitRepo, EbOpts *string
-	LmodInit, InstallDir                              string
+// copy of opts that can be changed without affecting opts
+func copyOpts(opts map[string]*string) map[string]*string {
+	result := make(map[string]*string)
+	for k, v := range opts {
+		c := *v
+		result[k] = &c
+	}
+	return result
+}
+
+// flag values by option name
+func optValues(opts map[string]*string) map[string]string {
+	values := make(map[string]string)
+	for k, v := range opts {
+		values[k] = *v
+	}
+	return values
+}
+
+// a rendered build command
+type build struct {
+	recipe    *samgx.Recipe
+	data      samgx.BuildCmdData
+	easystack *samgx.Easystack // nil if the recipe does not use one
+	resolved  []samgx.ResolvedEasyconfig
+	cmd       string
+
+	// the not yet installed part of easystack with -missing-only
+	easystackYAML string
+
+	// resolved options, recorded in the provenance header
+	params map[string]string
+}
+
+func renderBuild(lib *samgx.Library, opts map[string]*string, config *samgx.Config) (*build, error) {
+	defaultEbVer(opts)
+	recipe, err := lib.Recipe(*opts["recipe"])
+	if err != nil {
+		return nil, err
+	}
+	if recipe.UsesEasystack() {
+		if err := checkStack(opts, config); err != nil {
+			return nil, err
+		}
+	}
+	if missing := recipe.Missing(optValues(opts)); len(missing) > 0 {
+		return nil, fmt.Errorf("recipe %s requires -%s", recipe.Name, strings.Join(missing, ", -"))
+	}
+	b := &build{recipe: recipe, params: optValues(opts)}
+	if recipe.UsesEasystack() {
+		es, resolved, err := checkEasystack(opts, config)
+		if err != nil {
+			return nil, err
+		}
+		if planned := plannedEasystack(es); planned != nil {
+			log.Printf("using the easyconfigs of the plan instead of %s", es.Path)
+			if es, resolved, err = resolveEasystack(planned, opts, config); err != nil {
+				return nil, err
+			}
+			data, err := es.Marshal()
+			if err != nil {
+				return nil, err
+			}
+			b.easystackYAML = string(data)
+		}
+		logEasyconfigs(es, resolved)
+		b.easystack, b.resolved = es, resolved
+		if *missingOnlyFlag {
+			if b.easystackYAML, err = missingEasystack(opts, config, es, resolved, missingArch(opts)); err != nil {
+				return nil, err
+			}
+		}
+	} else if *missingOnlyFlag {
+		return nil, fmt.Errorf("-missing-only needs a recipe building an easystack, %s does not", recipe.Name)
+	}
+	ebOpts, err := samgx.SplitWords(*opts["ebopts"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid -ebopts: %w", err)
+	}
+	b.data = samgx.BuildCmdData{
+		StackVer:   *opts["stackver"],
+		Name:       *opts["name"],
+		Toolchain:  *opts["toolchain"],
+		EbVer:      *opts["ebver"],
+		GitRepo:    *opts["gitrepo"],
+		EbOpts:     ebOpts,
+		Easyconfig: *opts["easyconfig"],
+		LmodInit:   config.LmodInit,
+		InstallDir: config.InstallDir,
+
+		EasystackYAML: b.easystackYAML,
+	}
+	if b.data.EasyBuild, err = config.EasyBuildOptions(b.data.StackVer, b.data.Toolchain); err != nil {
+		return nil, err
+	}
+	if b.data.EasyBuildFormat, err = config.EasyBuildFormat(); err != nil {
+		return nil, err
+	}
+	b.data.CrtarRepo = config.CrtarRepo
+	if b.data.Modules, err = samgx.ExpandModules(config.Modules, b.data); err != nil {
+		return nil, err
+	}
+	b.data.ArchiveName = b.data.Name
+	if recipe.UsesEasystack() {
+		b.data.ArchiveName += "-" + b.data.Toolchain
+	}
+	if arch := *opts["arch"]; arch != "" {
+		a, err := config.Arch(arch)
+		if err != nil {
+			// build without the job options of the matrix
+			log.Printf("%s, building it without job options", err)
+			a.SoftwareSubdirOverride = arch
+		}
+		b.data.CpuArchSubdir = arch
+		b.data.SoftwareSubdirOverride = a.SoftwareSubdirOverride
+	} else if *missingOnlyFlag {
+		// archive the arch checked for missing modules
+		b.data.CpuArchSubdir = missingArch(opts)
+	}
+	var cmd bytes.Buffer
+	if err := lib.Render(&cmd, recipe.Name, b.data); err != nil {
+		return nil, err
+	}
+	b.cmd = cmd.String()
+	return b, nil
 }
 
-func buildCmd(tmpl string, data BuildCmdData) error {
-	t := template.Must(template.New("BuildCmd").Parse(tmpl))
-	err := t.Execute(os.Stdout, data)
+func buildCmd(lib *samgx.Library, opts map[string]*string, config *samgx.Config) error {
+	b, err := renderBuild(lib, opts, config)
+	if err != nil {
+		return err
+	}
+	if err := checkPlan(lib, b); err != nil {
+		return err
+	}
+	if *formatFlag == "json" {
+		return writePlan(lib, b)
+	}
+	out, err := script(lib, config, b, *formatFlag)
+	if err != nil {
+		return err
+	}
+	if *outputFlag != "" {
+		return writeScript(*outputFlag, out)
+	}
+	_, err = fmt.Print(out)
 	return err
 }
 
+// samgx recipes
+func listRecipes(lib *samgx.Library) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RECIPE\tREQUIRES\tDESCRIPTION")
+	for _, r := range lib.Recipes() {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", r.Name, strings.Join(r.Required, ","), r.Description)
+	}
+	w.Flush()
+}
+
 func main() {
+	// samgx [flags] [command] [flags]
 	opts := initOpts()
-	config := initConfig()
+	command := ""
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
 	if *versionFlag {
 		printVersion()
 		return
 	}
-	data := BuildCmdData{
-		StackVer:   opts["stackver"],
-		Name:       opts["name"],
-		Toolchain:  opts["toolchain"],
-		EbVer:      opts["ebver"],
-		GitRepo:    opts["gitrepo"],
-		EbOpts:     opts["ebopts"],
-		LmodInit:   config["lmodInit"],
-		InstallDir: config["installDir"],
-	}
-	err := buildCmd(config["buildCmdTmpl"], data)
+	config, err := samgx.LoadConfig(*configFlag)
+	if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	if err := applyConfigDefaults(opts, config); err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	if err := applyPlan(opts); err != nil {
+		log.Fatalf("%s\n", err)
+	}
+	if *opts["target"] != "" {
+		if err := config.UseTarget(*opts["target"]); err != nil {
+			log.Fatalf("%s\n", err)
+		}
+	}
+	applyPlanConfig(config)
+	lib, err := samgx.LoadLibrary(config)
+	if err != nil {
+		log.Fatalf("%s\n", err)
+	}
+
+	switch command {
+	case "":
+		err = buildCmd(lib, opts, config)
+	case "recipes":
+		listRecipes(lib)
+	case "easystack":
+		err = listEasystack(opts, config)
+	case "list":
+		err = listStacks(opts)
+	case "submit":
+		err = submitJob(lib, opts, config)
+	case "chain":
+		err = submitChain(lib, opts, config, flag.Args())
+	case "matrix":
+		err = writeMatrix(lib, opts, config)
+	case "status":
+		err = jobStatus(config)
+	default:
+		err = fmt.Errorf("unknown command %q", command)
+	}
 	if err != nil {
 		log.Fatalf("%s\n", err)
 	}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+var outdirFlag = flag.String("outdir", ".", "directory samgx matrix writes the job scripts to")
+
+// samgx matrix writes one job script per arch of the matrix (or only the one
+// given with -arch) to <outdir>/<job name>.sh
+func writeMatrix(lib *samgx.Library, opts map[string]*string, config *samgx.Config) error {
+	archs := []string{*opts["arch"]}
+	if archs[0] == "" {
+		archs = archs[:0]
+		for a := range config.Matrix {
+			archs = append(archs, a)
+		}
+		sort.Strings(archs)
+	}
+	if len(archs) == 0 {
+		return fmt.Errorf("no matrix in the config")
+	}
+	if *jobNameFlag != "" && len(archs) > 1 {
+		return fmt.Errorf("-job-name would be the same for all archs, use -arch")
+	}
+	if err := os.MkdirAll(*outdirFlag, 0o755); err != nil {
+		return err
+	}
+	for _, a := range archs {
+		archOpts := copyOpts(opts)
+		*archOpts["arch"] = a
+		b, err := renderBuild(lib, archOpts, config)
+		if err != nil {
+			return fmt.Errorf("arch %s: %w", a, err)
+		}
+		out, err := script(lib, config, b, "sbatch")
+		if err != nil {
+			return err
+		}
+		p := filepath.Join(*outdirFlag, jobData(config, b).JobName+".sh")
+		if err := writeScript(p, out); err != nil {
+			return err
+		}
+		fmt.Println(p)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+var outputFlag = flag.String("o", "", "write the script to this file (executable) instead of stdout")
+
+// script renders b in format (bash or sbatch) with a provenance header
+func script(lib *samgx.Library, config *samgx.Config, b *build, format string) (string, error) {
+	var out bytes.Buffer
+	switch format {
+	case "bash":
+		out.WriteString(b.cmd)
+	case "sbatch":
+		if err := lib.RenderJob(&out, jobData(config, b)); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unknown format %q", format)
+	}
+	params := map[string]string{"format": format}
+	if *missingOnlyFlag {
+		params["missing-only"] = "true"
+	}
+	if *allowMissingFlag {
+		params["allow-missing-easyconfigs"] = "true"
+	}
+	if *planFlag != "" {
+		params["plan"] = *planFlag
+	}
+	for k, v := range b.params {
+		params[k] = v
+	}
+	easystack := ""
+	if b.easystack != nil {
+		easystack = b.easystack.Path
+	}
+	p, err := samgx.NewProvenance(Version, params, b.data.GitRepo, easystack)
+	if err != nil {
+		return "", err
+	}
+	return p.AddHeader(out.String()), nil
+}
+
+// writeScript writes an executable script to p
+func writeScript(p, script string) error {
+	if err := os.WriteFile(p, []byte(script), 0o755); err != nil {
+		return fmt.Errorf("writing script: %w", err)
+	}
+	// WriteFile keeps the mode of an existing file
+	if err := os.Chmod(p, 0o755); err != nil {
+		return err
+	}
+	log.Printf("wrote %s", p)
+	return nil
+}
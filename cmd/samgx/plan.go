@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+var planFlag = flag.String("plan", "", "build plan (json, - for stdin) to render, as written by -format json")
+
+// the plan read with -plan
+var loadedPlan *samgx.Plan
+
+// applyPlan takes the options from the -plan. Options given on the command
+// line take precedence over the plan, the plan over the config.
+func applyPlan(opts map[string]*string) error {
+	if *planFlag == "" {
+		return nil
+	}
+	plan, err := samgx.ReadPlan(*planFlag)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for k, v := range plan.Params {
+		opt, ok := opts[k]
+		if !ok {
+			return fmt.Errorf("unknown option %q in plan %s", k, *planFlag)
+		}
+		if !set[k] {
+			*opt = v
+		}
+	}
+	loadedPlan = plan
+	return nil
+}
+
+// applyPlanConfig takes the install target settings from the -plan, they
+// take precedence over the target selected in the config
+func applyPlanConfig(config *samgx.Config) {
+	if loadedPlan == nil {
+		return
+	}
+	if loadedPlan.LmodInit != "" {
+		config.LmodInit = loadedPlan.LmodInit
+	}
+	if loadedPlan.InstallDir != "" {
+		config.InstallDir = loadedPlan.InstallDir
+	}
+	if len(loadedPlan.Modules) > 0 {
+		config.Modules = loadedPlan.Modules
+	}
+}
+
+// plannedEasystack returns the easyconfigs of the -plan as an easystack if they
+// differ from those of es
+func plannedEasystack(es *samgx.Easystack) *samgx.Easystack {
+	if loadedPlan == nil {
+		return nil
+	}
+	planned := loadedPlan.EasystackOf(es.Path)
+	if planned == nil {
+		return nil
+	}
+	// compare the yaml, options read from json and yaml differ in type
+	a, errA := es.Marshal()
+	b, errB := planned.Marshal()
+	if errA == nil && errB == nil && bytes.Equal(a, b) {
+		return nil
+	}
+	return planned
+}
+
+// checkPlan rejects a -plan whose easystack, crtar or tarball differ from
+// those derived for b
+func checkPlan(lib *samgx.Library, b *build) error {
+	if loadedPlan == nil {
+		return nil
+	}
+	derived, err := samgx.NewPlan(lib, b.recipe, b.params, b.data, b.easystack, b.resolved)
+	if err != nil {
+		return err
+	}
+	if err := loadedPlan.CheckDerived(derived); err != nil {
+		return fmt.Errorf("plan %s: %w", *planFlag, err)
+	}
+	return nil
+}
+
+// -format json
+func writePlan(lib *samgx.Library, b *build) error {
+	plan, err := samgx.NewPlan(lib, b.recipe, b.params, b.data, b.easystack, b.resolved)
+	if err != nil {
+		return err
+	}
+	if *outputFlag == "" {
+		return plan.Write(os.Stdout)
+	}
+	f, err := os.Create(*outputFlag)
+	if err != nil {
+		return fmt.Errorf("writing plan: %w", err)
+	}
+	defer f.Close()
+	return plan.Write(f)
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/samgx"
+)
+
+// samgx submit
+func submitJob(lib *samgx.Library, opts map[string]*string, config *samgx.Config) error {
+	b, err := renderBuild(lib, opts, config)
+	if err != nil {
+		return err
+	}
+	if err := checkPlan(lib, b); err != nil {
+		return err
+	}
+	// load the state first, a broken state file should not leave an untracked job
+	state, err := samgx.LoadJobState(config.StatePath())
+	if err != nil {
+		return err
+	}
+	job, err := submitBuild(lib, config, state, b, samgx.SubmittedJob{})
+	if err != nil {
+		return err
+	}
+	fmt.Println(job.JobID)
+	return nil
+}
+
+// submitBuild submits the job script of b and records it in state. Chain and
+// After of job are kept, the job waits for the jobs in After.
+func submitBuild(lib *samgx.Library, config *samgx.Config, state *samgx.JobState, b *build, job samgx.SubmittedJob) (samgx.SubmittedJob, error) {
+	data := jobData(config, b)
+	out, err := script(lib, config, b, "sbatch")
+	if err != nil {
+		return job, err
+	}
+	sbatch := append(strings.Fields(config.Slurm.Sbatch), samgx.DependencyArgs(job.After)...)
+	id, err := samgx.Submit(sbatch, strings.NewReader(out))
+	if err != nil {
+		return job, err
+	}
+	job.JobID = id
+	job.JobName = data.JobName
+	job.Recipe = b.recipe.Name
+	job.StackVer = b.data.StackVer
+	job.Toolchain = b.data.Toolchain
+	job.Easyconfig = b.data.Easyconfig
+	job.GitRepo = b.data.GitRepo
+	job.GitCommit = samgx.GitCommit(b.data.GitRepo)
+	job.Submitted = time.Now().UTC()
+	if b.easystack != nil {
+		job.Easystack = b.easystack.Path
+	}
+	if err := state.Add(job); err != nil {
+		return job, fmt.Errorf("job %s submitted but not recorded: %w", id, err)
+	}
+	log.Printf("submitted job %s (%s), recorded in %s", id, data.JobName, state.Path)
+	return job, nil
+}
+
+// samgx status
+func jobStatus(config *samgx.Config) error {
+	state, err := samgx.LoadJobState(config.StatePath())
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, j := range state.Jobs {
+		ids = append(ids, j.JobID)
+	}
+	states, err := samgx.JobStates(strings.Fields(config.Slurm.Squeue), strings.Fields(config.Slurm.Sacct), ids)
+	if err != nil {
+		log.Printf("warning: %s", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOBID\tNAME\tSTACK\tTOOLCHAIN\tCOMMIT\tSUBMITTED\tCHAIN\tSTATE")
+	var chains []string
+	chainStates := make(map[string][]string)
+	for _, j := range state.Jobs {
+		s, ok := states[j.JobID]
+		if !ok {
+			s = "UNKNOWN"
+		}
+		commit := j.GitCommit
+		if len(commit) > 12 {
+			commit = commit[:12]
+		}
+		chain := j.Chain
+		if chain == "" {
+			chain = "-"
+		} else {
+			if _, ok := chainStates[chain]; !ok {
+				chains = append(chains, chain)
+			}
+			chainStates[chain] = append(chainStates[chain], s)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", j.JobID, j.JobName, j.StackVer, j.Toolchain,
+			commit, j.Submitted.Local().Format(time.DateTime), chain, s)
+	}
+	w.Flush()
+	if len(chains) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAIN\tJOBS\tSTATE")
+	for _, c := range chains {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", c, len(chainStates[c]), samgx.ChainState(chainStates[c]))
+	}
+	w.Flush()
+	return nil
+}
@@ -17,17 +17,35 @@ import (
 	"time"
 )
 
+// cpuArchSubdir archived when none is given
+const DefaultCpuArchSubdir = "x86_64/amd/zen4"
+
+// cpuArchSubdir recorded for -paths tarballs when none is given, their files
+// are usually not specific to an arch
+const GenericCpuArchSubdir = "generic"
+
+// cvmfs catalog markers and overlay whiteout files never end up in a tarball
+var excludes = []string{".cvmfscatalog", "*.wh.*"}
+
+// A Companion is a file describing a tarball that is written next to it
+type Companion interface {
+	Write(tarballPath string) error
+}
+
 // tar --exclude=.cvmfscatalog --exclude=*.wh.* -C ${TOPDIR} -czf ${TARBALL} --files-from=${FILES_LIST}
 // TOPDIR=workingDir
 // TARBALL=tarballName
 // FILES_LIST=listFile
 // Change to the workingDir and create a tarball named tarballName using the
-// files in the listFile. Exclude anything mathching the two regular expressions
-// at the front of the args slice.
-func ExecTar(repo, cpuArchSubdir, name, outdir string, listFile *os.File) ([]string, error) {
+// files in the listFile. Exclude anything mathching the patterns in excludes.
+// The companions (manifest, sbom) are written next to the tarball before the
+// lockfile is removed, so an ingestion service never sees a tarball without
+// them.
+func ExecTar(repo, cpuArchSubdir, name, outdir string, listFile *os.File, companions ...Companion) ([]string, error) {
 	var args []string
-	// second exclude is redundant because of the filter below
-	args = append(args, "--exclude=.cvmfscatalog", "--exclude=*.wh.*")
+	for _, e := range excludes {
+		args = append(args, fmt.Sprintf("--exclude=%s", e))
+	}
 	workingDir := versionsDir(repo)
 	args = append(args, "-C", workingDir)
 	tarball := tarballPath(cpuArchSubdir, name, outdir)
@@ -37,22 +55,32 @@ func ExecTar(repo, cpuArchSubdir, name, outdir string, listFile *os.File) ([]str
 
 	lockFile, lferr := acquireLockfile(tarball)
 	if lferr != nil {
-		return nil, fmt.Errorf("could not acquire lockfile %s: %w", lockFile.Name(), lferr)
+		return nil, fmt.Errorf("could not acquire lockfile for %s: %w", tarball, lferr)
 	}
 	stdout, err := runCmd("tar", args)
 	if err != nil {
 		return nil, fmt.Errorf("creating tarball %s failed %w", tarball, err)
 	}
 	log.Printf("tarball %s created", tarball)
+	for _, c := range companions {
+		if err := c.Write(tarball); err != nil {
+			return nil, fmt.Errorf("writing companion of %s: %w", tarball, err)
+		}
+	}
 	removeLockfile(lockFile)
 	return stdout, nil
 }
 
-func tarballPath(cpuArchSubdir, name, outdir string) string {
+// TarballName returns <name>-<arch>-<timestamp>.tar.gz with the "/" of the
+// arch replaced by "-"
+func TarballName(cpuArchSubdir, name, ts string) string {
 	normalizedArchDir := strings.ReplaceAll(cpuArchSubdir, "/", "-")
-	t := time.Now()
-	ts := t.Format("20060102150405")
-	result := fmt.Sprintf("%s/%s-%s-%s.tar.gz", outdir, name, normalizedArchDir, ts)
+	return fmt.Sprintf("%s-%s-%s.tar.gz", name, normalizedArchDir, ts)
+}
+
+func tarballPath(cpuArchSubdir, name, outdir string) string {
+	ts := time.Now().Format("20060102150405")
+	result := fmt.Sprintf("%s/%s", outdir, TarballName(cpuArchSubdir, name, ts))
 	log.Printf("tarballPath -> %s", result)
 	return result
 }
@@ -80,23 +108,27 @@ func archDir(repo string, version string, cpuArchSubdir string) string {
 // Lockfiles are created in order to prevent race conditions whereby the
 // ingestion service tries to read a partially written tarball
 func acquireLockfile(tarballPath string) (*os.File, error) {
-	name := strings.TrimRight(tarballPath, ".tar.gz")
-	lf := fmt.Sprintf("%s.lock", name)
-	lockFilePath := filepath.Clean(lf)
+	lockFilePath := LockfilePath(tarballPath)
 	log.Printf("acquireLockfile find or create -> %s", lockFilePath)
 
 	if _, err := os.Stat(lockFilePath); err == nil { // lockfile found!
 		return nil, fmt.Errorf("lockfile %s already present %w", lockFilePath, err)
 	} else {
 		result, err := os.Create(lockFilePath)
-		log.Printf("aquireLockfile created -> %s\n", result.Name())
 		if err != nil {
 			return nil, fmt.Errorf("acquireLockfile failed to create %s: %w", lockFilePath, err)
 		}
+		log.Printf("aquireLockfile created -> %s\n", result.Name())
 		return result, nil
 	}
 }
 
+// LockfilePath returns the lockfile guarding tarballPath while it is written
+func LockfilePath(tarballPath string) string {
+	name := strings.TrimSuffix(tarballPath, ".tar.gz")
+	return filepath.Clean(fmt.Sprintf("%s.lock", name))
+}
+
 func removeLockfile(lockFile *os.File) error {
 	err := os.Remove(lockFile.Name())
 	if err != nil {
@@ -162,11 +194,9 @@ func findSoftware(searchPath string) ([]string, error) {
 		return result, nil
 	}
 
-	var absPaths []string
-
 	// build the find args
 	// find <match1> ... <matchN> -maxdepth 1 -name easybuild -type d
-	args := append([]string{}, absPaths...)
+	args := append([]string{}, matches...)
 	// easybuild dirs
 	args = append(args, "-maxdepth", "1", "-name", "easybuild", "-type", "d")
 
@@ -177,6 +207,9 @@ func findSoftware(searchPath string) ([]string, error) {
 	}
 
 	for _, easyBuildDir := range sRes {
+		if strings.TrimSpace(easyBuildDir) == "" {
+			continue
+		}
 		p := filepath.Dir(filepath.Clean(easyBuildDir))
 
 		result = append(result, p)
@@ -195,38 +228,45 @@ func newListFile(workdir string) (*os.File, error) {
 	return file, nil
 }
 
-func MakeListFile(repo, version, cpuArchSubdir string) (*os.File, error) {
-
+// ArchDirEntries collects the module files and software directories below
+// versions/<version>/software/linux/<cpuArchSubdir> of the overlay upper dir.
+func ArchDirEntries(repo, version, cpuArchSubdir string) (modules, software []string, err error) {
 	archDir := archDir(repo, version, cpuArchSubdir)
 
-	// file list for the tarball
-	var fileList []string
-
-	modules, err := findModules(archDir)
+	modules, err = findModules(archDir)
 	if err != nil {
-		log.Println("Error finding modules: ", err)
-		log.Println("exiting")
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("finding modules in %s: %w", archDir, err)
 	}
-	fileList = append(fileList, modules...)
+	modules = trimEntries(modules)
 
-	software, err := findSoftware(archDir)
+	software, err = findSoftware(archDir)
 	if err != nil {
-		log.Println("Error finding software: ", err)
-		log.Println("exiting")
-		os.Exit(1)
+		return nil, nil, fmt.Errorf("finding software in %s: %w", archDir, err)
 	}
+	software = trimEntries(software)
+	return modules, software, nil
+}
 
-	fileList = append(fileList, software...)
-
-	//for i := range(fileList) {
-	//	fmt.Println(fileList[i])
-	//}
+// drop the blank lines left over from splitting command output
+func trimEntries(entries []string) []string {
+	result := []string{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
 
+// MakeListFile writes fileList to a temporary file in the versions dir of repo,
+// the result is passed to tar via --files-from.
+func MakeListFile(repo string, fileList []string) (*os.File, error) {
 	workdir := versionsDir(repo)
 	tmpfile, err := newListFile(workdir)
 	if err != nil {
-		log.Fatalf("creating tmpfile in %s failed", workdir)
+		return nil, fmt.Errorf("creating tmpfile in %s: %w", workdir, err)
 	}
 	// write any files we've found
 	writer := bufio.NewWriter(tmpfile)
@@ -4,6 +4,17 @@
 */
 package crtar
 
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
 // Real test case for FindModules 
 // {EESSI 2023.06} Apptainer> find  /tmp/software.asc.ac.at/overlay-upper/versions/2023.06/software/linux/x86_64/amd/zen4/modules/ -type f
 // /tmp/software.asc.ac.at/overlay-upper/versions/2023.06/software/linux/x86_64/amd/zen4/modules/all/Go/1.25.0.lua
@@ -15,3 +26,423 @@ package crtar
 // /tmp/software.asc.ac.at/overlay-upper/versions/2023.06/software/linux/x86_64/amd/zen4/software/Go/1.25.0/easybuild
 // {EESSI 2023.06} Apptainer> find ${ARCHDIR}/software/*/* -maxdepth 1 -name easybuild -type d | xargs -r dirname
 // /tmp/software.asc.ac.at/overlay-upper/versions/2023.06/software/linux/x86_64/amd/zen4/software/Go/1.25.0
+
+func TestFindReplacements(t *testing.T) {
+	upper := t.TempDir()
+	lower := t.TempDir()
+	sw := "versions/2023.06/software/linux/x86_64/amd/zen4/software/Go"
+	for _, d := range []string{
+		filepath.Join(upper, sw, "1.25.0"),
+		filepath.Join(upper, sw, "1.24.1"),
+		filepath.Join(lower, sw, "1.24.1"),
+	} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries := []string{
+		filepath.Join(upper, sw, "1.25.0"),
+		filepath.Join(upper, sw, "1.24.1"),
+	}
+	got, err := findReplacements(upper, lower, KindSoftware, entries)
+	if err != nil {
+		t.Fatalf("findReplacements: %s", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("findReplacements got %d replacements, want 1", len(got))
+	}
+	want := Replacement{KindSoftware, entries[1], filepath.Join(lower, sw, "1.24.1")}
+	if got[0] != want {
+		t.Errorf("findReplacements got %v, want %v", got[0], want)
+	}
+
+	if _, err := findReplacements(upper, lower, KindModule, []string{"/elsewhere/Go/1.25.0.lua"}); err == nil {
+		t.Errorf("findReplacements accepted an entry outside of %s", upper)
+	}
+}
+
+func TestSubtreeEntries(t *testing.T) {
+	upper := t.TempDir()
+	for _, f := range []string{
+		"versions/2023.06/init/bash",
+		"versions/2023.06/init/lmod/bash",
+		"versions/2023.06/init/.cvmfscatalog",
+		"versions/2023.06/init/.wh.old_script",
+		"versions/2025.06/init/lmod/bash",
+	} {
+		p := filepath.Join(upper, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := subtreeEntries(upper, []string{"versions/2023.06/init", "versions/*/init/lmod"})
+	if err != nil {
+		t.Fatalf("subtreeEntries: %s", err)
+	}
+	want := []string{
+		filepath.Join(upper, "versions/2023.06/init/bash"),
+		filepath.Join(upper, "versions/2023.06/init/lmod/bash"),
+		filepath.Join(upper, "versions/2025.06/init/lmod/bash"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("subtreeEntries got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("subtreeEntries got %s, want %s", got[i], want[i])
+		}
+	}
+
+	for _, p := range []string{"/versions", "../elsewhere", "versions/2024.*"} {
+		if _, err := subtreeEntries(upper, []string{p}); err == nil {
+			t.Errorf("subtreeEntries(%q) succeeded, want error", p)
+		}
+	}
+}
+
+// use /bin/sh as a stand-in for the ingestion service
+func TestWatchOnce(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	good := write("Go-1.25.0-x86_64-amd-zen4-20250101120000.tar.gz", "good")
+	if err := (&Manifest{}).Write(good); err != nil {
+		t.Fatal(err)
+	}
+	bad := write("Go-1.24.1-x86_64-amd-zen4-20250101120000.tar.gz", "bad")
+	if err := (&Manifest{}).Write(bad); err != nil {
+		t.Fatal(err)
+	}
+	write("Go-1.24.1-x86_64-amd-zen4-20250101120000.tar.gz", "tampered")
+	locked := write("Go-1.23.0-x86_64-amd-zen4-20250101120000.tar.gz", "locked")
+	write("Go-1.23.0-x86_64-amd-zen4-20250101120000.lock", "")
+
+	opts := WatchOptions{
+		Dir:       dir,
+		IngestCmd: []string{"/bin/sh", "-c", `test -f "$0"`},
+		Once:      true,
+	}
+	if err := Watch(opts); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+
+	for _, p := range []string{
+		filepath.Join(dir, DoneDir, filepath.Base(good)),
+		filepath.Join(dir, DoneDir, filepath.Base(ManifestPath(good))),
+		filepath.Join(dir, DoneDir, "Go-1.25.0-x86_64-amd-zen4-20250101120000.log"),
+		filepath.Join(dir, FailedDir, filepath.Base(bad)),
+		filepath.Join(dir, FailedDir, "Go-1.24.1-x86_64-amd-zen4-20250101120000.log"),
+		locked,
+	} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Watch: expected %s: %s", p, err)
+		}
+	}
+}
+
+// a tarball whose move to done/ failed is not ingested a second time
+func TestWatchMoveFailed(t *testing.T) {
+	dir := t.TempDir()
+	tarball := filepath.Join(dir, "Go-1.25.0-x86_64-amd-zen4-20250101120000.tar.gz")
+	if err := os.WriteFile(tarball, []byte("good"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// a non-empty directory in the way makes the rename fail, even for root
+	blocker := filepath.Join(dir, DoneDir, filepath.Base(tarball))
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	calls := filepath.Join(dir, "calls")
+	opts := WatchOptions{
+		Dir:       dir,
+		IngestCmd: []string{"/bin/sh", "-c", `echo "$1" >> "$0"`, calls},
+		Once:      true,
+	}
+	if err := Watch(opts); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	if _, err := os.Stat(IngestedMarkerPath(tarball)); err != nil {
+		t.Fatalf("Watch: no ingested marker after a failed move: %s", err)
+	}
+
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := Watch(opts); err != nil {
+		t.Fatalf("Watch: %s", err)
+	}
+	out, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "\n"); n != 1 {
+		t.Errorf("Watch ran the ingestion command %d times, want 1", n)
+	}
+	moved := filepath.Join(dir, DoneDir, filepath.Base(tarball))
+	for _, p := range []string{moved, IngestedMarkerPath(moved)} {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Watch: expected %s: %s", p, err)
+		}
+	}
+	ingestLog, err := os.ReadFile(logPath(moved))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"ingesting", "already ingested"} {
+		if !strings.Contains(string(ingestLog), want) {
+			t.Errorf("Watch log %q does not contain %q", ingestLog, want)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, DoneDir)
+	if err := os.MkdirAll(done, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	tarballs := []struct {
+		dir      string
+		ts       string
+		ingested bool
+	}{
+		{done, "20250101120000", true}, // old, removed
+		{done, "20250201120000", true}, // old, removed
+		{dir, "20250215120000", false}, // old, not ingested
+		{done, "20250301120000", true}, // kept by -keep 2
+		{done, "20250610120000", true}, // kept by -keep 2 and -keep-days
+	}
+	var paths []string
+	for _, tb := range tarballs {
+		p := filepath.Join(tb.dir, "Go-1.25.0-x86_64-amd-zen4-"+tb.ts+".tar.gz")
+		paths = append(paths, p)
+		if err := os.WriteFile(p, []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if tb.ingested {
+			if err := os.WriteFile(IngestedMarkerPath(p), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	now, _ := time.ParseInLocation("20060102150405", "20250615120000", time.Local)
+	opts := PruneOptions{Dir: dir, Keep: 2, KeepDays: 30, DryRun: true, Now: now}
+
+	res, err := Prune(opts)
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if len(res.Removed) != 2 || res.Reclaimed != 20 {
+		t.Fatalf("Prune dry-run removed %v (%d bytes), want 2 tarballs (20 bytes)", res.Removed, res.Reclaimed)
+	}
+	if _, err := os.Stat(paths[0]); err != nil {
+		t.Errorf("Prune dry-run removed %s", paths[0])
+	}
+
+	opts.DryRun = false
+	if _, err := Prune(opts); err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	for i, p := range paths {
+		_, err := os.Stat(p)
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("Prune %s removed = %t", p, removed)
+		}
+	}
+	if _, err := os.Stat(IngestedMarkerPath(paths[0])); !os.IsNotExist(err) {
+		t.Errorf("Prune left the ingested marker of %s", paths[0])
+	}
+}
+
+func TestPruneFailed(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, DoneDir)
+	failed := filepath.Join(dir, FailedDir)
+	for _, d := range []string{done, failed} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarballs := []struct {
+		dir      string
+		ts       string
+		ingested bool
+		removed  bool
+	}{
+		{failed, "20250101120000", false, true},  // older than -failed-days
+		{done, "20250201120000", true, true},     // old, removed
+		{done, "20250301120000", true, false},    // kept by -keep 1
+		{failed, "20250401120000", false, false}, // younger than -failed-days
+		{failed, "20250610120000", false, false}, // does not count toward -keep
+	}
+	var paths []string
+	for _, tb := range tarballs {
+		p := filepath.Join(tb.dir, "Go-1.25.0-x86_64-amd-zen4-"+tb.ts+".tar.gz")
+		paths = append(paths, p)
+		if err := os.WriteFile(p, []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if tb.ingested {
+			if err := os.WriteFile(IngestedMarkerPath(p), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	now, _ := time.ParseInLocation("20060102150405", "20250615120000", time.Local)
+	res, err := Prune(PruneOptions{Dir: dir, Keep: 1, FailedDays: 90, DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	var want []string
+	for i, tb := range tarballs {
+		if tb.removed {
+			want = append(want, paths[i])
+		}
+	}
+	sort.Strings(res.Removed)
+	sort.Strings(want)
+	if !reflect.DeepEqual(res.Removed, want) {
+		t.Errorf("Prune removed %v, want %v", res.Removed, want)
+	}
+
+	// without -failed-days failed tarballs are kept
+	res, err = Prune(PruneOptions{Dir: dir, Keep: 1, DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	if !reflect.DeepEqual(res.Removed, []string{paths[1]}) {
+		t.Errorf("Prune without FailedDays removed %v, want %v", res.Removed, paths[1:2])
+	}
+}
+
+const testEasyconfig = `easyblock = 'ConfigureMake'
+
+name = 'zstd'
+version = '1.5.5'
+
+homepage = 'https://facebook.github.io/zstd'
+description = """Zstandard is a real-time compression algorithm,
+ providing high compression ratios."""
+
+toolchain = {'name': 'GCCcore', 'version': '13.2.0'}
+
+builddependencies = [
+    ('binutils', '2.40'),
+]
+
+dependencies = [
+    ('zlib', '1.2.13'),
+    ('gzip', '1.13'),
+    ('XZ', '5.4.4'),
+    ('lz4', '1.9.4'),
+]
+`
+
+func TestParseEasyconfig(t *testing.T) {
+	ec := ParseEasyconfig(testEasyconfig)
+	if ec.Name != "zstd" || ec.Version != "1.5.5" {
+		t.Errorf("ParseEasyconfig got %s %s, want zstd 1.5.5", ec.Name, ec.Version)
+	}
+	if ec.ToolchainName != "GCCcore" || ec.ToolchainVersion != "13.2.0" {
+		t.Errorf("ParseEasyconfig got toolchain %s/%s, want GCCcore/13.2.0", ec.ToolchainName, ec.ToolchainVersion)
+	}
+	if ec.Homepage != "https://facebook.github.io/zstd" {
+		t.Errorf("ParseEasyconfig got homepage %s", ec.Homepage)
+	}
+	want := []string{"zlib/1.2.13", "gzip/1.13", "XZ/5.4.4", "lz4/1.9.4"}
+	if len(ec.Dependencies) != len(want) {
+		t.Fatalf("ParseEasyconfig got dependencies %v, want %v", ec.Dependencies, want)
+	}
+	for i := range want {
+		if ec.Dependencies[i] != want[i] {
+			t.Errorf("ParseEasyconfig got dependency %s, want %s", ec.Dependencies[i], want[i])
+		}
+	}
+
+	if ec := ParseEasyconfig("name = 'Go'\nversion = '1.25.0'\ntoolchain = SYSTEM\n"); ec.ToolchainName != "system" {
+		t.Errorf("ParseEasyconfig got toolchain %q for SYSTEM", ec.ToolchainName)
+	}
+}
+
+func TestSBOMWrite(t *testing.T) {
+	dir := t.TempDir()
+	sw := filepath.Join(dir, "software", "zstd", "1.5.5-GCCcore-13.2.0")
+	files := map[string]string{
+		"easybuild/zstd-1.5.5-GCCcore-13.2.0.eb": testEasyconfig,
+		"share/doc/zstd/LICENSE":                 "BSD License",
+		"share/doc/zstd/COPYING":                 "GPLv2",
+		"bin/zstd":                               "",
+	}
+	for f, content := range files {
+		p := filepath.Join(sw, f)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarball := filepath.Join(dir, "zstd-x86_64-amd-zen4-20250101120000.tar.gz")
+	s := &SBOM{ToolVersion: "test", SoftwareDirs: []string{sw}}
+	if err := s.Write(tarball); err != nil {
+		t.Fatalf("SBOM.Write: %s", err)
+	}
+
+	data, err := os.ReadFile(SBOMPath(tarball))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bom cdxBOM
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatalf("decoding sbom: %s", err)
+	}
+	if bom.BOMFormat != "CycloneDX" || len(bom.Components) != 1 {
+		t.Fatalf("SBOM.Write got %s with %d components", bom.BOMFormat, len(bom.Components))
+	}
+	c := bom.Components[0]
+	if c.Name != "zstd" || c.Version != "1.5.5-GCCcore-13.2.0" || len(c.Licenses) != 2 {
+		t.Errorf("SBOM.Write got component %s %s with %d licenses", c.Name, c.Version, len(c.Licenses))
+	}
+}
+
+func TestPruneSamgxNames(t *testing.T) {
+	dir := t.TempDir()
+	// as created from samgx: -name <name>-<toolchain>-"${TS}"
+	names := []string{
+		"foss-foss-2023b-2501011200-x86_64-amd-zen4-20250101120000.tar.gz",
+		"foss-foss-2023b-2502011200-x86_64-amd-zen4-20250201120000.tar.gz",
+		"foss-foss-2023b-2503011200-x86_64-amd-zen4-20250301120000.tar.gz",
+		"foss-foss-2023b-2501011200-x86_64-intel-sapphirerapids-20250101120000.tar.gz",
+	}
+	for _, n := range names {
+		p := filepath.Join(dir, n)
+		if err := os.WriteFile(p, []byte("0123456789"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(IngestedMarkerPath(p), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now, _ := time.ParseInLocation("20060102150405", "20250615120000", time.Local)
+	res, err := Prune(PruneOptions{Dir: dir, Keep: 1, DryRun: true, Now: now})
+	if err != nil {
+		t.Fatalf("Prune: %s", err)
+	}
+	var removed []string
+	for _, p := range res.Removed {
+		removed = append(removed, filepath.Base(p))
+	}
+	sort.Strings(removed)
+	if want := names[:2]; !reflect.DeepEqual(removed, want) {
+		t.Errorf("Prune removed %v, want %v", removed, want)
+	}
+}
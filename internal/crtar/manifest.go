@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+// Manifest describes the contents of a tarball, it is written next to the
+// tarball as <name>-<arch>-<timestamp>.manifest.json
+type Manifest struct {
+	Tarball       string        `json:"tarball"`
+	SHA256        string        `json:"sha256"`
+	Created       string        `json:"created"`
+	Repo          string        `json:"repo"`
+	Version       string        `json:"version"`
+	CpuArchSubdir string        `json:"cpu_arch_subdir"`
+	Paths         []string      `json:"paths,omitempty"`
+	Files         []string      `json:"files"`
+	Replacements  []Replacement `json:"replacements,omitempty"`
+	ReplaceReason string        `json:"replace_reason,omitempty"`
+
+	// reason given with -skip-replace-check, the files were not checked
+	// against the published repository
+	ReplaceCheckSkipped string `json:"replace_check_skipped,omitempty"`
+}
+
+// ManifestPath returns the path of the manifest belonging to tarballPath
+func ManifestPath(tarballPath string) string {
+	return strings.TrimSuffix(tarballPath, ".tar.gz") + ".manifest.json"
+}
+
+// Write fills in the checksum of the tarball and saves the manifest next to it
+func (m *Manifest) Write(tarballPath string) error {
+	sum, err := util.FileSHA256(tarballPath)
+	if err != nil {
+		return err
+	}
+	m.Tarball = filepath.Base(tarballPath)
+	m.SHA256 = sum
+	m.Created = time.Now().UTC().Format(time.RFC3339)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	p := ManifestPath(tarballPath)
+	if err := os.WriteFile(p, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing manifest %s: %w", p, err)
+	}
+	log.Printf("manifest %s created", p)
+	return nil
+}
+
+// ReadManifest loads the manifest from p
+func ReadManifest(p string) (*Manifest, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("decoding manifest %s: %w", p, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+type PruneOptions struct {
+	// output directory of crtar, done/ and failed/ below it are pruned as well
+	Dir string
+
+	// number of ingested tarballs to keep per package and arch
+	Keep int
+
+	// tarballs younger than this are always kept
+	KeepDays int
+
+	// tarballs in failed/ older than this are removed, 0 keeps them
+	FailedDays int
+
+	// only report what would be removed
+	DryRun bool
+
+	// reference time for KeepDays and FailedDays, time.Now() if zero
+	Now time.Time
+}
+
+type PruneResult struct {
+	Removed   []string
+	Kept      []string
+	Reclaimed int64
+}
+
+type pruneCandidate struct {
+	path     string
+	group    string
+	created  time.Time
+	ingested bool
+	failed   bool
+}
+
+// <name>-<arch>-<timestamp>.tar.gz as created by tarballPath
+var tarballNameRe = regexp.MustCompile(`^(.+)-(\d{14})\.tar\.gz$`)
+
+// samgx passes -name <name>-<toolchain>-<YYMMDDhhmm>, the build timestamp is
+// not part of the package
+var buildTimestampRe = regexp.MustCompile(`-\d{10}(-|$)`)
+
+// pruneGroup returns the package and arch part of <name>-<arch>, without the
+// build timestamp samgx puts into the name
+func pruneGroup(nameArch string) string {
+	return buildTimestampRe.ReplaceAllString(nameArch, "$1")
+}
+
+// Prune removes old tarballs from the output directory. A tarball is kept when
+// it is one of the newest opts.Keep ingested tarballs of its package and arch,
+// when it is younger than opts.KeepDays or when it has no ingested marker.
+// Tarballs in failed/ do not count toward opts.Keep, they are removed once
+// they are older than opts.FailedDays.
+func Prune(opts PruneOptions) (*PruneResult, error) {
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	cutoff := now.AddDate(0, 0, -opts.KeepDays)
+	failedCutoff := now.AddDate(0, 0, -opts.FailedDays)
+
+	var candidates []pruneCandidate
+	for _, d := range []string{opts.Dir, filepath.Join(opts.Dir, DoneDir), filepath.Join(opts.Dir, FailedDir)} {
+		c, err := pruneCandidates(d)
+		if err != nil {
+			return nil, err
+		}
+		for i := range c {
+			c[i].failed = d == filepath.Join(opts.Dir, FailedDir)
+		}
+		candidates = append(candidates, c...)
+	}
+
+	groups := make(map[string][]pruneCandidate)
+	for _, c := range candidates {
+		groups[c.group] = append(groups[c.group], c)
+	}
+
+	result := &PruneResult{}
+	for _, g := range sortedKeys(groups) {
+		tarballs := groups[g]
+		// newest first
+		sort.Slice(tarballs, func(i, j int) bool {
+			return tarballs[i].created.After(tarballs[j].created)
+		})
+		ingested := 0
+		for _, t := range tarballs {
+			var keep bool
+			switch {
+			case t.failed:
+				keep = opts.FailedDays <= 0 || t.created.After(failedCutoff)
+			case !t.ingested:
+				keep = true
+			default:
+				keep = ingested < opts.Keep || t.created.After(cutoff)
+				ingested++
+			}
+			if keep {
+				result.Kept = append(result.Kept, t.path)
+				continue
+			}
+			size, err := removeTarball(t.path, opts.DryRun)
+			if err != nil {
+				return result, err
+			}
+			result.Removed = append(result.Removed, t.path)
+			result.Reclaimed += size
+		}
+	}
+	return result, nil
+}
+
+func pruneCandidates(dir string) ([]pruneCandidate, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("glob error for %q: %w", dir, err)
+	}
+	var result []pruneCandidate
+	for _, m := range matches {
+		if _, err := os.Stat(LockfilePath(m)); err == nil {
+			// still being written
+			continue
+		}
+		c := pruneCandidate{path: m}
+		if _, err := os.Stat(IngestedMarkerPath(m)); err == nil {
+			c.ingested = true
+		}
+		sub := tarballNameRe.FindStringSubmatch(filepath.Base(m))
+		if sub != nil {
+			c.group = pruneGroup(sub[1])
+			c.created, err = time.ParseInLocation("20060102150405", sub[2], time.Local)
+		}
+		if sub == nil || err != nil {
+			log.Printf("prune: cannot parse %s, using mtime", m)
+			fi, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			c.group = filepath.Base(m)
+			c.created = fi.ModTime()
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+// remove a tarball together with everything crtar and watch put next to it,
+// returns the number of bytes freed
+func removeTarball(tarball string, dryRun bool) (int64, error) {
+	var size int64
+	for _, p := range tarballFiles(tarball) {
+		fi, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		size += fi.Size()
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			return size, fmt.Errorf("prune %s: %w", p, err)
+		}
+	}
+	return size, nil
+}
+
+// the tarball and its companion files
+func tarballFiles(tarball string) []string {
+	return []string{
+		tarball,
+		ManifestPath(tarball),
+		SBOMPath(tarball),
+		signaturePath(tarball),
+		logPath(tarball),
+		IngestedMarkerPath(tarball),
+	}
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	KindModule   = "module"
+	KindSoftware = "software"
+	KindFile     = "file"
+)
+
+// A Replacement is an entry of the tarball that already exists in the read
+// only (published) repository. Ingesting the tarball would replace it.
+type Replacement struct {
+	Kind  string `json:"kind"`
+	Path  string `json:"path"`
+	Lower string `json:"lower"`
+}
+
+// get the lower (read only) layer of the writeable overlay
+// samctr mounts the published repository at /cvmfs_ro/<repo> and uses it as
+// the lowerdir of fuse-overlayfs (or the RO branch of unionfs)
+func lowerDir(repo string) string {
+	return path.Join("/cvmfs_ro", repo)
+}
+
+// FindReplacements checks every module file and software dir about to be
+// archived against the lower layer of repo.
+func FindReplacements(repo string, modules, software []string) ([]Replacement, error) {
+	upper, lower, err := overlayLayers(repo)
+	if err != nil {
+		return nil, err
+	}
+	var result []Replacement
+	m, err := findReplacements(upper, lower, KindModule, modules)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, m...)
+	s, err := findReplacements(upper, lower, KindSoftware, software)
+	if err != nil {
+		return nil, err
+	}
+	result = append(result, s...)
+	return result, nil
+}
+
+// FindFileReplacements checks the files collected by SubtreeEntries against
+// the lower layer of repo.
+func FindFileReplacements(repo string, files []string) ([]Replacement, error) {
+	upper, lower, err := overlayLayers(repo)
+	if err != nil {
+		return nil, err
+	}
+	return findReplacements(upper, lower, KindFile, files)
+}
+
+func overlayLayers(repo string) (string, string, error) {
+	lower := lowerDir(repo)
+	if _, err := os.Stat(lower); err != nil {
+		return "", "", fmt.Errorf("lower layer %s not available: %w", lower, err)
+	}
+	return overlayUpperDir(repo), lower, nil
+}
+
+func findReplacements(upper, lower, kind string, entries []string) ([]Replacement, error) {
+	var result []Replacement
+	for _, e := range entries {
+		rel, err := filepath.Rel(upper, e)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return nil, fmt.Errorf("entry %s is not below %s", e, upper)
+		}
+		lowerPath := filepath.Join(lower, rel)
+		if _, err := os.Lstat(lowerPath); err == nil {
+			log.Printf("replacement: %s %s already published at %s", kind, e, lowerPath)
+			result = append(result, Replacement{Kind: kind, Path: e, Lower: lowerPath})
+		} else if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("stat %s: %w", lowerPath, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,382 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// licenses are looked for this many levels below a software dir
+const licenseSearchDepth = 4
+
+// Easyconfig holds the metadata crtar reads from the easyconfig that EasyBuild
+// copies to <software dir>/easybuild/
+type Easyconfig struct {
+	File             string
+	Name             string
+	Version          string
+	VersionSuffix    string
+	ToolchainName    string
+	ToolchainVersion string
+	Homepage         string
+	Description      string
+	Dependencies     []string
+}
+
+// An SBOM is a CycloneDX (json) description of the software dirs in a tarball,
+// written next to the tarball as <name>-<arch>-<timestamp>.sbom.json
+type SBOM struct {
+	// crtar version recorded as the tool that created the sbom
+	ToolVersion string
+
+	// software dirs as found by ArchDirEntries
+	SoftwareDirs []string
+}
+
+func SBOMPath(tarballPath string) string {
+	return strings.TrimSuffix(tarballPath, ".tar.gz") + ".sbom.json"
+}
+
+type cdxBOM struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	Licenses           []cdxLicense     `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+}
+
+type cdxLicense struct {
+	License cdxLicenseText `json:"license"`
+}
+
+type cdxLicenseText struct {
+	Name       string         `json:"name"`
+	Text       cdxTextContent `json:"text"`
+	Properties []cdxProperty  `json:"properties,omitempty"`
+}
+
+type cdxTextContent struct {
+	ContentType string `json:"contentType"`
+	Content     string `json:"content"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Write collects the easybuild metadata and license files of all software
+// dirs and saves them as a CycloneDX sbom next to the tarball
+func (s *SBOM) Write(tarballPath string) error {
+	bom := cdxBOM{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "crtar", Version: s.ToolVersion},
+			}},
+			Component: cdxComponent{Type: "file", Name: filepath.Base(tarballPath)},
+		},
+		Components: []cdxComponent{},
+	}
+	for _, d := range s.SoftwareDirs {
+		c, err := softwareComponent(d)
+		if err != nil {
+			return err
+		}
+		bom.Components = append(bom.Components, c)
+	}
+
+	data, err := json.MarshalIndent(bom, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding sbom: %w", err)
+	}
+	p := SBOMPath(tarballPath)
+	if err := os.WriteFile(p, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing sbom %s: %w", p, err)
+	}
+	log.Printf("sbom %s created", p)
+	return nil
+}
+
+func softwareComponent(softwareDir string) (cdxComponent, error) {
+	// software/<name>/<version>
+	c := cdxComponent{
+		Type:    "application",
+		Name:    filepath.Base(filepath.Dir(softwareDir)),
+		Version: filepath.Base(softwareDir),
+	}
+	c.BOMRef = c.Name + "/" + c.Version
+
+	ec, err := readEasyconfig(filepath.Join(softwareDir, "easybuild"))
+	if err != nil {
+		return c, err
+	}
+	if ec != nil {
+		c.Description = ec.Description
+		if ec.Homepage != "" {
+			c.ExternalReferences = append(c.ExternalReferences, cdxExternalRef{Type: "website", URL: ec.Homepage})
+		}
+		c.Properties = append(c.Properties,
+			cdxProperty{"easybuild:easyconfig", ec.File},
+			cdxProperty{"easybuild:name", ec.Name},
+			cdxProperty{"easybuild:version", ec.Version + ec.VersionSuffix},
+			cdxProperty{"easybuild:toolchain", strings.Trim(ec.ToolchainName+"/"+ec.ToolchainVersion, "/")},
+		)
+		for _, dep := range ec.Dependencies {
+			c.Properties = append(c.Properties, cdxProperty{"easybuild:dependency", dep})
+		}
+	} else {
+		log.Printf("sbom: no easyconfig found in %s", softwareDir)
+	}
+
+	licenses, err := findLicenseFiles(softwareDir)
+	if err != nil {
+		return c, err
+	}
+	for _, l := range licenses {
+		text, err := os.ReadFile(filepath.Join(softwareDir, l))
+		if err != nil {
+			return c, fmt.Errorf("reading license %s: %w", l, err)
+		}
+		// the license is not identified, only its text is recorded
+		c.Licenses = append(c.Licenses, cdxLicense{cdxLicenseText{
+			Name:       fmt.Sprintf("License text (%s)", l),
+			Text:       cdxTextContent{ContentType: "text/plain", Content: string(text)},
+			Properties: []cdxProperty{{"crtar:license-file", l}},
+		}})
+	}
+	return c, nil
+}
+
+// findLicenseFiles returns the LICENSE/LICENCE/COPYING files below dir,
+// relative to dir
+func findLicenseFiles(dir string) ([]string, error) {
+	var result []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if d.IsDir() {
+			if rel != "." && strings.Count(rel, string(os.PathSeparator)) >= licenseSearchDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		name := strings.ToUpper(d.Name())
+		for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING"} {
+			if strings.HasPrefix(name, prefix) {
+				result = append(result, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("searching licenses in %s: %w", dir, err)
+	}
+	return result, nil
+}
+
+// the easyconfig is python, only the simple assignments used by EasyBuild
+// for its parameters are understood
+var (
+	ecStringRe = func(key string) *regexp.Regexp {
+		return regexp.MustCompile(`(?ms)^` + key + `\s*=\s*(?:"""(.*?)"""|'''(.*?)'''|"([^"]*)"|'([^']*)')`)
+	}
+	ecNameRe          = ecStringRe("name")
+	ecVersionRe       = ecStringRe("version")
+	ecVersionSuffixRe = ecStringRe("versionsuffix")
+	ecHomepageRe      = ecStringRe("homepage")
+	ecDescriptionRe   = ecStringRe("description")
+	ecToolchainRe     = regexp.MustCompile(`(?m)^toolchain\s*=\s*(SYSTEM|\{[^}]*\})`)
+	ecTcKeyRe         = regexp.MustCompile(`['"](name|version)['"]\s*:\s*['"]([^'"]*)['"]`)
+	ecDependenciesRe  = regexp.MustCompile(`(?m)^dependencies\s*=\s*\[`)
+	ecDepRe           = regexp.MustCompile(`^\(\s*['"]([^'"]+)['"]\s*,\s*['"]([^'"]*)['"]`)
+)
+
+// skipPython returns the index after the string literal or comment starting
+// at s[i], i if there is none
+func skipPython(s string, i int) int {
+	switch s[i] {
+	case '#':
+		if end := strings.IndexByte(s[i:], '\n'); end >= 0 {
+			return i + end
+		}
+		return len(s)
+	case '\'', '"':
+		for j := i + 1; j < len(s); j++ {
+			switch s[j] {
+			case '\\':
+				j++
+			case s[i]:
+				return j + 1
+			}
+		}
+		return len(s)
+	}
+	return i
+}
+
+// matchBracket returns the index of the bracket closing the one at s[i],
+// brackets in strings and comments are skipped. It is -1 if there is none.
+func matchBracket(s string, i int) int {
+	depth := 0
+	for j := i; j < len(s); {
+		if k := skipPython(s, j); k != j {
+			j = k
+			continue
+		}
+		switch s[j] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+		j++
+	}
+	return -1
+}
+
+// ecDependencies returns the name/version of the tuples of the dependencies
+// list, tuples may hold nested tuples and lists
+func ecDependencies(data string) []string {
+	loc := ecDependenciesRe.FindStringIndex(data)
+	if loc == nil {
+		return nil
+	}
+	end := matchBracket(data, loc[1]-1)
+	if end < 0 {
+		return nil
+	}
+	list := data[loc[1]:end]
+	var result []string
+	for i := 0; i < len(list); {
+		if k := skipPython(list, i); k != i {
+			i = k
+			continue
+		}
+		switch list[i] {
+		case '(', '[', '{':
+			j := matchBracket(list, i)
+			if j < 0 {
+				return result
+			}
+			if m := ecDepRe.FindStringSubmatch(list[i : j+1]); m != nil {
+				result = append(result, m[1]+"/"+m[2])
+			}
+			i = j + 1
+		default:
+			i++
+		}
+	}
+	return result
+}
+
+func ecString(re *regexp.Regexp, ec string) string {
+	m := re.FindStringSubmatch(ec)
+	for _, s := range m[min(1, len(m)):] {
+		if s != "" {
+			return strings.TrimSpace(s)
+		}
+	}
+	return ""
+}
+
+// readEasyconfig parses the *.eb file in an easybuild dir, a nil result means
+// there was none
+func readEasyconfig(easybuildDir string) (*Easyconfig, error) {
+	matches, err := filepath.Glob(filepath.Join(easybuildDir, "*.eb"))
+	if err != nil || len(matches) == 0 {
+		return nil, err
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		return nil, fmt.Errorf("reading easyconfig %s: %w", matches[0], err)
+	}
+	ec := ParseEasyconfig(string(data))
+	ec.File = filepath.Base(matches[0])
+	return ec, nil
+}
+
+// ParseEasyconfig extracts name, version, toolchain and dependencies
+func ParseEasyconfig(data string) *Easyconfig {
+	ec := &Easyconfig{
+		Name:          ecString(ecNameRe, data),
+		Version:       ecString(ecVersionRe, data),
+		VersionSuffix: ecString(ecVersionSuffixRe, data),
+		Homepage:      ecString(ecHomepageRe, data),
+		Description:   ecString(ecDescriptionRe, data),
+	}
+	if m := ecToolchainRe.FindStringSubmatch(data); m != nil {
+		if m[1] == "SYSTEM" {
+			ec.ToolchainName = "system"
+		}
+		for _, kv := range ecTcKeyRe.FindAllStringSubmatch(m[1], -1) {
+			if kv[1] == "name" {
+				ec.ToolchainName = kv[2]
+			} else {
+				ec.ToolchainVersion = kv[2]
+			}
+		}
+	}
+	ec.Dependencies = ecDependencies(data)
+	return ec
+}
+
+// random (version 4) uuid for the sbom serial number
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
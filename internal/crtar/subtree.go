@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// SubtreeEntries collects the files and symlinks below the paths (or globs)
+// given in patterns. Patterns are relative to the overlay upper dir of repo,
+// e.g. "versions/2023.06/init" or "versions/*/init/lmod/*".
+func SubtreeEntries(repo string, patterns []string) ([]string, error) {
+	return subtreeEntries(overlayUpperDir(repo), patterns)
+}
+
+func subtreeEntries(upper string, patterns []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if filepath.IsAbs(p) || !filepath.IsLocal(p) {
+			return nil, fmt.Errorf("path %q must be relative to %s", p, upper)
+		}
+		pattern := filepath.Join(upper, p)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("glob error for %q: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("path %q matches nothing below %s", p, upper)
+		}
+		for _, m := range matches {
+			err := filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if isExcluded(d.Name()) {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				// like find -type f and find -type l
+				if d.Type().IsRegular() || d.Type()&fs.ModeSymlink != 0 {
+					if !seen[path] {
+						seen[path] = true
+						result = append(result, path)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("walking %s: %w", m, err)
+			}
+		}
+		log.Printf("SubtreeEntries %s -> %d matches", p, len(matches))
+	}
+	return result, nil
+}
+
+// check name against the same patterns that are passed to tar --exclude
+func isExcluded(name string) bool {
+	for _, e := range excludes {
+		if ok, _ := filepath.Match(e, name); ok {
+			return true
+		}
+	}
+	return false
+}
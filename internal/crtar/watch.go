@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package crtar
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+)
+
+type WatchOptions struct {
+	// output directory of crtar, completed tarballs are picked up from here
+	Dir string
+
+	// ingestion command, the path of the tarball is appended as last arg
+	IngestCmd []string
+
+	// command used to check <tarball>.sig, called as <cmd...> <sig> <tarball>
+	VerifyCmd []string
+
+	// time between two scans of Dir
+	Interval time.Duration
+
+	// process whatever is in Dir once and return
+	Once bool
+}
+
+// Watch scans the output directory for completed tarballs and hands each of
+// them to the ingestion command. Tarballs end up in done/ or failed/ below the
+// output directory together with their manifest, sbom, signature and a log.
+func Watch(opts WatchOptions) error {
+	if len(opts.IngestCmd) == 0 {
+		return fmt.Errorf("no ingestion command given")
+	}
+	for _, d := range []string{DoneDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(opts.Dir, d), 0o755); err != nil {
+			return fmt.Errorf("create %s dir: %w", d, err)
+		}
+	}
+	for {
+		tarballs, err := CompletedTarballs(opts.Dir)
+		if err != nil {
+			return err
+		}
+		for _, t := range tarballs {
+			if err := ingest(opts, t); err != nil {
+				log.Printf("ingest %s failed: %s", t, err)
+			}
+		}
+		if opts.Once {
+			return nil
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+// CompletedTarballs lists the tarballs in dir that are not (or no longer)
+// guarded by a lockfile.
+func CompletedTarballs(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.tar.gz"))
+	if err != nil {
+		return nil, fmt.Errorf("glob error for %q: %w", dir, err)
+	}
+	var result []string
+	for _, m := range matches {
+		if _, err := os.Stat(LockfilePath(m)); err == nil {
+			log.Printf("CompletedTarballs skipping locked %s", m)
+			continue
+		}
+		result = append(result, m)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// verify, ingest and move a single tarball, the returned error is also written
+// to the log that accompanies the tarball. A tarball with an ingested marker
+// is only moved, it was ingested before but could not be moved to done/.
+func ingest(opts WatchOptions, tarball string) error {
+	var ingestLog bytes.Buffer
+	logf := func(format string, args ...any) {
+		fmt.Fprintf(&ingestLog, "%s %s\n", time.Now().Format(time.RFC3339), fmt.Sprintf(format, args...))
+	}
+
+	var err error
+	if ingestedBefore(opts, tarball) {
+		logf("%s already ingested, not ingesting it again", tarball)
+	} else {
+		logf("ingesting %s", tarball)
+		err = verifyTarball(opts, tarball, logf)
+		if err == nil {
+			err = runLogged(&ingestLog, append(opts.IngestCmd, tarball))
+		}
+		if err == nil {
+			// written before the move, tarballs without this marker are
+			// never pruned
+			marker := IngestedMarkerPath(tarball)
+			ts := time.Now().Format(time.RFC3339) + "\n"
+			if mErr := os.WriteFile(marker, []byte(ts), 0o644); mErr != nil {
+				return fmt.Errorf("writing ingested marker %s: %w", marker, mErr)
+			}
+		}
+	}
+	dest := DoneDir
+	if err != nil {
+		logf("FAILED: %s", err)
+		dest = FailedDir
+	} else {
+		logf("ingested")
+	}
+	destDir := filepath.Join(opts.Dir, dest)
+	if mvErr := moveTarball(tarball, destDir, ingestLog.Bytes()); mvErr != nil {
+		return fmt.Errorf("moving %s to %s: %w", tarball, dest, mvErr)
+	}
+	log.Printf("ingest %s -> %s", tarball, dest)
+	return err
+}
+
+// check the tarball against its manifest and signature when present
+func verifyTarball(opts WatchOptions, tarball string, logf func(string, ...any)) error {
+	mp := ManifestPath(tarball)
+	if _, err := os.Stat(mp); err == nil {
+		m, err := ReadManifest(mp)
+		if err != nil {
+			return err
+		}
+		sum, err := util.FileSHA256(tarball)
+		if err != nil {
+			return err
+		}
+		if m.SHA256 != sum {
+			return fmt.Errorf("sha256 mismatch for %s: manifest %s, tarball %s", tarball, m.SHA256, sum)
+		}
+		logf("manifest %s verified", mp)
+	} else {
+		logf("no manifest found")
+	}
+
+	sig := signaturePath(tarball)
+	if _, err := os.Stat(sig); err == nil {
+		if len(opts.VerifyCmd) == 0 {
+			return fmt.Errorf("signature %s present but no verify command given", sig)
+		}
+		out, err := exec.Command(opts.VerifyCmd[0], append(opts.VerifyCmd[1:], sig, tarball)...).CombinedOutput()
+		logf("verify signature:\n%s", out)
+		if err != nil {
+			return fmt.Errorf("signature verification of %s failed: %w", tarball, err)
+		}
+	}
+	return nil
+}
+
+func signaturePath(tarball string) string {
+	return tarball + ".sig"
+}
+
+func logPath(tarball string) string {
+	return strings.TrimSuffix(tarball, ".tar.gz") + ".log"
+}
+
+// ingestedBefore reports whether tarball has an ingested marker next to it or
+// in done/, left behind by a move that failed after the ingestion
+func ingestedBefore(opts WatchOptions, tarball string) bool {
+	marker := IngestedMarkerPath(tarball)
+	for _, p := range []string{marker, filepath.Join(opts.Dir, DoneDir, filepath.Base(marker))} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// IngestedMarkerPath returns the marker written by watch once tarball has
+// been ingested successfully
+func IngestedMarkerPath(tarball string) string {
+	return strings.TrimSuffix(tarball, ".tar.gz") + ".ingested"
+}
+
+func runLogged(ingestLog *bytes.Buffer, command []string) error {
+	fmt.Fprintf(ingestLog, "$ %s\n", strings.Join(command, " "))
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = ingestLog
+	cmd.Stderr = ingestLog
+	return cmd.Run()
+}
+
+// append ingestLog to the log next to the tarball, then move the tarball and
+// its companions to dir. The log of an earlier attempt whose move failed is
+// kept that way.
+func moveTarball(tarball, dir string, ingestLog []byte) error {
+	f, err := os.OpenFile(logPath(tarball), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(ingestLog)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{tarball, ManifestPath(tarball), SBOMPath(tarball), signaturePath(tarball), IngestedMarkerPath(tarball), logPath(tarball)} {
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		if err := os.Rename(p, filepath.Join(dir, filepath.Base(p))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Settings are the (not yet decoded) values of a config file, keyed by the
+// config keys
+type Settings map[string]any
+
+// lists merged by MergeSettings instead of being replaced: fusemounts entries
+// are matched by their fuse_arg, so a later entry for the same repository
+// replaces the earlier one, bind_paths are appended unless already present
+var mergedLists = map[string]string{
+	"fusemounts": "fuse_arg",
+	"bind_paths": "",
+}
+
+// MergeSettings returns base with over merged in. Values of over replace
+// those of base, maps are merged key by key and the lists named in
+// mergedLists are merged entry by entry. base and over are not modified.
+func MergeSettings(base, over Settings) Settings {
+	result := make(Settings, len(base)+len(over))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range over {
+		result[k] = mergeValue(k, result[k], v)
+	}
+	return result
+}
+
+func mergeValue(key string, base, over any) any {
+	if bm, ok := asMap(base); ok {
+		if om, ok := asMap(over); ok {
+			return map[string]any(MergeSettings(bm, om))
+		}
+	}
+	idKey, ok := mergedLists[key]
+	if !ok {
+		return over
+	}
+	bl, bok := base.([]any)
+	ol, ook := over.([]any)
+	if !bok || !ook {
+		return over
+	}
+	result := append([]any{}, bl...)
+	for _, o := range ol {
+		i := indexOf(result, o, idKey)
+		if i < 0 {
+			result = append(result, o)
+		} else {
+			result[i] = o
+		}
+	}
+	return result
+}
+
+// indexOf returns the index of the entry of list matching v, compared by the
+// idKey of map entries or as a whole, -1 if there is none
+func indexOf(list []any, v any, idKey string) int {
+	id, hasID := entryID(v, idKey)
+	for i, e := range list {
+		if hasID {
+			if eid, ok := entryID(e, idKey); ok && eid == id {
+				return i
+			}
+		} else if reflect.DeepEqual(e, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+func entryID(v any, idKey string) (string, bool) {
+	m, ok := asMap(v)
+	if !ok || idKey == "" {
+		return "", false
+	}
+	id, ok := m[idKey]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(id), true
+}
+
+// asMap returns v if it is a map of settings
+func asMap(v any) (map[string]any, bool) {
+	switch m := v.(type) {
+	case map[string]any:
+		return m, true
+	case Settings:
+		return m, true
+	}
+	return nil, false
+}
+
+// Profiles returns the profiles section of the settings by name
+func (s Settings) Profiles() (map[string]Settings, error) {
+	raw, ok := s["profiles"]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	m, ok := asMap(raw)
+	if !ok {
+		return nil, fmt.Errorf("configuration error: profiles must map profile names to settings")
+	}
+	result := make(map[string]Settings, len(m))
+	for name, p := range m {
+		ps, ok := asMap(p)
+		if !ok && p != nil {
+			return nil, fmt.Errorf("configuration error: profile %s must hold settings", name)
+		}
+		result[name] = ps
+	}
+	return result, nil
+}
+
+// ProfileNames returns the sorted names of the profiles
+func (s Settings) ProfileNames() []string {
+	profiles, _ := s.Profiles()
+	var names []string
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyProfile returns the settings with the profile name merged into the
+// base config, see MergeSettings. The profiles section is left out. An empty
+// name selects no profile.
+func (s Settings) ApplyProfile(name string) (Settings, error) {
+	profiles, err := s.Profiles()
+	if err != nil {
+		return nil, err
+	}
+	base := make(Settings, len(s))
+	for k, v := range s {
+		if k != "profiles" {
+			base[k] = v
+		}
+	}
+	if name == "" {
+		return base, nil
+	}
+	p, ok := profiles[name]
+	if !ok {
+		names := s.ProfileNames()
+		if len(names) == 0 {
+			return nil, fmt.Errorf("configuration error: unknown profile %q, the config defines no profiles", name)
+		}
+		return nil, fmt.Errorf("configuration error: unknown profile %q (profiles: %s)", name, strings.Join(names, ", "))
+	}
+	return MergeSettings(base, p), nil
+}
+
+// A Layer is a set of settings merged into the config, a config file or a
+// profile
+type Layer struct {
+	// path of the config file or "profile <name>"
+	Name     string
+	Settings Settings
+}
+
+// Source returns the name of the last of the layers setting key, empty if
+// none does
+func Source(layers []Layer, key string) string {
+	for i := len(layers) - 1; i >= 0; i-- {
+		if _, ok := layers[i].Settings[key]; ok {
+			return layers[i].Name
+		}
+	}
+	return ""
+}
+
+// EntrySource returns the name of the last of the layers whose list key
+// holds entry, entries are matched like MergeSettings does. For lists
+// MergeSettings replaces it is the Source of the key.
+func EntrySource(layers []Layer, key string, entry any) string {
+	idKey, ok := mergedLists[key]
+	if !ok {
+		return Source(layers, key)
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		if list, ok := layers[i].Settings[key].([]any); ok && indexOf(list, entry, idKey) >= 0 {
+			return layers[i].Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func fuseMountSetting(arg, mountpoint string) map[string]any {
+	return map[string]any{"type": "container", "fuse_cmd": "cvmfs2", "fuse_arg": arg, "ctr_mountpoint": mountpoint}
+}
+
+func TestMergeSettings(t *testing.T) {
+	base := Settings{
+		"image":           "docker://base",
+		"fusemounts":      []any{fuseMountSetting("cvmfs-config.cern.ch", "/cvmfs/cvmfs-config.cern.ch"), fuseMountSetting("software.eessi.io", "/cvmfs/software.eessi.io")},
+		"bind_paths":      []any{"/a:/a:ro"},
+		"writeable_repos": []any{"software.eessi.io"},
+	}
+	over := Settings{
+		"image":           "docker://over",
+		"fusemounts":      []any{fuseMountSetting("software.eessi.io", "/cvmfs_ro/software.eessi.io"), fuseMountSetting("software.asc.ac.at", "/cvmfs/software.asc.ac.at")},
+		"bind_paths":      []any{"/a:/a:ro", "/b:/b:rw"},
+		"writeable_repos": []any{"software.asc.ac.at"},
+	}
+	want := Settings{
+		"image": "docker://over",
+		"fusemounts": []any{
+			fuseMountSetting("cvmfs-config.cern.ch", "/cvmfs/cvmfs-config.cern.ch"),
+			fuseMountSetting("software.eessi.io", "/cvmfs_ro/software.eessi.io"),
+			fuseMountSetting("software.asc.ac.at", "/cvmfs/software.asc.ac.at"),
+		},
+		"bind_paths":      []any{"/a:/a:ro", "/b:/b:rw"},
+		"writeable_repos": []any{"software.asc.ac.at"},
+	}
+	got := MergeSettings(base, over)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeSettings got %v, want %v", got, want)
+	}
+	if base["image"] != "docker://base" || len(base["fusemounts"].([]any)) != 2 {
+		t.Errorf("MergeSettings modified base: %v", base)
+	}
+}
+
+func TestApplyProfile(t *testing.T) {
+	s := Settings{
+		"image":      "docker://base",
+		"bind_paths": []any{"/a:/a:ro"},
+		"profiles": map[string]any{
+			"gpu": map[string]any{"bind_paths": []any{"/nv:/nv:ro"}, "nvidia": "all"},
+			"rw":  map[string]any{"writeable_repos": []any{"software.eessi.io"}},
+		},
+	}
+	if names := s.ProfileNames(); !reflect.DeepEqual(names, []string{"gpu", "rw"}) {
+		t.Errorf("ProfileNames got %v", names)
+	}
+	got, err := s.ApplyProfile("gpu")
+	if err != nil {
+		t.Fatalf("ApplyProfile: %s", err)
+	}
+	want := Settings{"image": "docker://base", "bind_paths": []any{"/a:/a:ro", "/nv:/nv:ro"}, "nvidia": "all"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ApplyProfile(gpu) got %v, want %v", got, want)
+	}
+	if got, _ := s.ApplyProfile(""); !reflect.DeepEqual(got, Settings{"image": "docker://base", "bind_paths": []any{"/a:/a:ro"}}) {
+		t.Errorf("ApplyProfile without profile got %v", got)
+	}
+	if _, err := s.ApplyProfile("gpus"); err == nil || !strings.Contains(err.Error(), "profiles: gpu, rw") {
+		t.Errorf("ApplyProfile of an unknown profile got %v", err)
+	}
+}
+
+func TestMergeSettingsLayers(t *testing.T) {
+	system := Settings{
+		"image": "docker://site",
+		"profiles": map[string]any{
+			"gpu": map[string]any{"bind_paths": []any{"/nv:/nv:ro"}},
+		},
+	}
+	user := Settings{
+		"profiles": map[string]any{
+			"gpu": map[string]any{"bind_paths": []any{"/cuda:/cuda:ro"}},
+			"rw":  map[string]any{"writeable_repos": []any{"software.eessi.io"}},
+		},
+	}
+	got := MergeSettings(system, user)
+	want := Settings{
+		"image": "docker://site",
+		"profiles": map[string]any{
+			"gpu": map[string]any{"bind_paths": []any{"/nv:/nv:ro", "/cuda:/cuda:ro"}},
+			"rw":  map[string]any{"writeable_repos": []any{"software.eessi.io"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeSettings got %v, want %v", got, want)
+	}
+}
+
+func TestSource(t *testing.T) {
+	layers := []Layer{
+		{"/etc/samctr/config.yaml", Settings{
+			"image":      "docker://site",
+			"fusemounts": []any{fuseMountSetting("software.eessi.io", "/cvmfs/software.eessi.io")},
+		}},
+		{"/home/u/.config/samctr/config.yaml", Settings{
+			"fusemounts": []any{fuseMountSetting("software.asc.ac.at", "/cvmfs/software.asc.ac.at")},
+		}},
+		{"profile rw", Settings{
+			"fusemounts": []any{fuseMountSetting("software.eessi.io", "/cvmfs_ro/software.eessi.io")},
+		}},
+	}
+	if got := Source(layers, "image"); got != "/etc/samctr/config.yaml" {
+		t.Errorf("Source(image) got %q", got)
+	}
+	if got := Source(layers, "nvidia"); got != "" {
+		t.Errorf("Source(nvidia) got %q", got)
+	}
+	var tests = []struct {
+		entry any
+		want  string
+	}{
+		{fuseMountSetting("software.eessi.io", "/cvmfs_ro/software.eessi.io"), "profile rw"},
+		{fuseMountSetting("software.asc.ac.at", "/cvmfs/software.asc.ac.at"), "/home/u/.config/samctr/config.yaml"},
+		{fuseMountSetting("cvmfs-config.cern.ch", "/cvmfs/cvmfs-config.cern.ch"), ""},
+	}
+	for _, tt := range tests {
+		if got := EntrySource(layers, "fusemounts", tt.entry); got != tt.want {
+			t.Errorf("EntrySource(%v) got %q, want %q", tt.entry, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"fmt"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+// Suggest returns ", did you mean "<closest>"?" for an unknown key s, empty
+// if none of the candidates is close enough
+func Suggest(s string, candidates []string) string {
+	best := util.ClosestMatch(s, candidates)
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
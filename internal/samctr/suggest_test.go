@@ -0,0 +1,25 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import "testing"
+
+func TestSuggest(t *testing.T) {
+	keys := []string{"image", "fusemounts", "writeable_repos", "fuse_cmd_rw", "bind_paths"}
+	var tests = []struct {
+		key, want string
+	}{
+		{"writable_repos", `, did you mean "writeable_repos"?`},
+		{"fusemount", `, did you mean "fusemounts"?`},
+		{"bindpaths", `, did you mean "bind_paths"?`},
+		{"imgae", `, did you mean "image"?`},
+		{"nvidia_mode", ""},
+	}
+	for _, tt := range tests {
+		if got := Suggest(tt.key, keys); got != tt.want {
+			t.Errorf("Suggest(%s) got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Stage of a job chain builds the easystack of one toolchain after the
+// stages listed in After have completed successfully
+type Stage struct {
+	// referenced by After, defaults to the toolchain
+	ID        string   `yaml:"id"`
+	Toolchain string   `yaml:"toolchain"`
+	Name      string   `yaml:"name"`
+	Recipe    string   `yaml:"recipe"`
+	EbVer     string   `yaml:"ebver"`
+	After     []string `yaml:"after"`
+}
+
+func (s Stage) Key() string {
+	if s.ID != "" {
+		return s.ID
+	}
+	return s.Toolchain
+}
+
+// ParseStage parses a stage given on the command line as
+// <toolchain>[:<after>[,<after>...]]
+func ParseStage(arg string) (Stage, error) {
+	toolchain, after, _ := strings.Cut(arg, ":")
+	if toolchain == "" {
+		return Stage{}, fmt.Errorf("invalid stage %q, want <toolchain>[:<after>,...]", arg)
+	}
+	s := Stage{Toolchain: toolchain}
+	for _, a := range strings.Split(after, ",") {
+		if a != "" {
+			s.After = append(s.After, a)
+		}
+	}
+	return s, nil
+}
+
+// OrderStages sorts the stages so that every stage comes after the stages it
+// depends on, otherwise the given order is kept
+func OrderStages(stages []Stage) ([]Stage, error) {
+	index := make(map[string]int)
+	for i, s := range stages {
+		if _, ok := index[s.Key()]; ok {
+			return nil, fmt.Errorf("stage %s listed twice", s.Key())
+		}
+		index[s.Key()] = i
+	}
+	for _, s := range stages {
+		for _, a := range s.After {
+			if _, ok := index[a]; !ok {
+				return nil, fmt.Errorf("stage %s depends on unknown stage %s", s.Key(), a)
+			}
+		}
+	}
+
+	var result []Stage
+	done := make(map[string]bool)
+	for len(result) < len(stages) {
+		progress := false
+		for _, s := range stages {
+			if done[s.Key()] || !stageReady(s, done) {
+				continue
+			}
+			result = append(result, s)
+			done[s.Key()] = true
+			progress = true
+		}
+		if !progress {
+			var cycle []string
+			for _, s := range stages {
+				if !done[s.Key()] {
+					cycle = append(cycle, s.Key())
+				}
+			}
+			return nil, fmt.Errorf("dependency cycle between stages %s", strings.Join(cycle, ", "))
+		}
+	}
+	return result, nil
+}
+
+func stageReady(s Stage, done map[string]bool) bool {
+	for _, a := range s.After {
+		if !done[a] {
+			return false
+		}
+	}
+	return true
+}
+
+// DependencyArgs returns the sbatch options making a job wait for the jobs
+// ids. Should one of them fail the job is cancelled by slurm.
+func DependencyArgs(ids []string) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	return []string{
+		"--dependency=afterok:" + strings.Join(ids, ":"),
+		"--kill-on-invalid-dep=yes",
+	}
+}
+
+// ChainState summarizes the slurm states of the jobs of a chain
+func ChainState(states []string) string {
+	count := make(map[string]int)
+	for _, s := range states {
+		count[s]++
+	}
+	switch {
+	case count["FAILED"]+count["CANCELLED"]+count["TIMEOUT"]+count["OUT_OF_MEMORY"]+count["NODE_FAIL"] > 0:
+		return "FAILED"
+	case count["COMPLETED"] == len(states):
+		return "COMPLETED"
+	case count["RUNNING"]+count["COMPLETING"]+count["COMPLETED"] > 0:
+		return "RUNNING"
+	case count["PENDING"] == len(states):
+		return "PENDING"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,291 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Config holds the site configuration of samgx.
+//
+// Note that the file is decoded with yaml directly rather than with viper
+// (as samctr does), viper lower-cases keys and splits them on "." which breaks
+// stack versions like "2025.06" used as keys.
+type Config struct {
+	// the default install target, see Target
+	LmodInit   string   `yaml:"lmod_init"`
+	InstallDir string   `yaml:"install_dir"`
+	Modules    []string `yaml:"modules"`
+	CrtarRepo  string   `yaml:"crtar_repo"`
+
+	// named install targets selected with -target
+	Targets map[string]Target `yaml:"targets"`
+
+	// directory of named templates (recipes) and partials, relative paths are
+	// resolved against the directory of the config file
+	TemplateDir string `yaml:"template_dir"`
+
+	// path to a file replacing the default recipe
+	BuildCmdTemplate string `yaml:"build_cmd_template"`
+
+	// defaults for the command line options (stackver, ebver, ...)
+	Defaults map[string]string `yaml:"defaults"`
+
+	// per stack version overrides of Defaults
+	Stacks map[string]map[string]string `yaml:"stacks"`
+
+	// searched for the easyconfigs of an easystack that are not in the git
+	// repo, before the robot-paths of the easybuild section. Unlike those,
+	// they are not passed on to eb.
+	RobotPaths []string `yaml:"robot_paths"`
+
+	// asked for the toolchains known to EasyBuild when checking -toolchain,
+	// empty to skip the check
+	EbCommand string `yaml:"eb_command"`
+
+	// #SBATCH directives of generated job scripts
+	Slurm SlurmConfig `yaml:"slurm"`
+
+	// options passed to samctr in generated job scripts
+	Samctr SamctrConfig `yaml:"samctr"`
+
+	// EasyBuild settings of the build session
+	EasyBuild EasyBuildConfig `yaml:"easybuild"`
+
+	// per cpuArchSubdir job options, see Arch
+	Matrix map[string]Arch `yaml:"matrix"`
+
+	// job chains submitted with samgx chain -pipeline <name>
+	Pipelines map[string][]Stage `yaml:"pipelines"`
+
+	// jobs submitted with samgx submit
+	StateFile string `yaml:"state_file"`
+
+	// file the config was read from, empty if none was found
+	Path string `yaml:"-"`
+}
+
+// A Target is a repository samgx builds for: where the software is installed
+// (EESSI_PROJECT_INSTALL), the Lmod init script, the modules to load before
+// EESSI-extend and the cvmfs repository passed to crtar. Modules are
+// templates executed with the BuildCmdData, e.g. "ASC/{{ .StackVer }}".
+// Empty values are taken from the top level of the config.
+type Target struct {
+	LmodInit   string   `yaml:"lmod_init"`
+	InstallDir string   `yaml:"install_dir"`
+	Modules    []string `yaml:"modules"`
+	CrtarRepo  string   `yaml:"crtar_repo"`
+}
+
+// UseTarget replaces the default target of the config by the target name
+func (c *Config) UseTarget(name string) error {
+	t, ok := c.Targets[name]
+	if !ok {
+		return fmt.Errorf("unknown target %q, available: %s", name, strings.Join(sortedKeys(c.Targets), ", "))
+	}
+	if t.LmodInit != "" {
+		c.LmodInit = t.LmodInit
+	}
+	if t.InstallDir != "" {
+		c.InstallDir = t.InstallDir
+	}
+	if len(t.Modules) > 0 {
+		c.Modules = t.Modules
+	}
+	if t.CrtarRepo != "" {
+		c.CrtarRepo = t.CrtarRepo
+	}
+	return nil
+}
+
+// JobOptions are turned into #SBATCH directives, empty values are left out
+type JobOptions struct {
+	Partition string `yaml:"partition"`
+	Mem       string `yaml:"mem"`
+	Time      string `yaml:"time"`
+	Cpus      string `yaml:"cpus"`
+}
+
+type SlurmConfig struct {
+	JobOptions `yaml:",inline"`
+
+	// per toolchain overrides of the options above
+	Toolchains map[string]JobOptions `yaml:"toolchains"`
+
+	// commands used by samgx submit and status, may include arguments
+	Sbatch string `yaml:"sbatch"`
+	Squeue string `yaml:"squeue"`
+	Sacct  string `yaml:"sacct"`
+}
+
+// Arch holds the settings for building for one cpuArchSubdir (e.g.
+// x86_64/amd/zen4) of the matrix
+type Arch struct {
+	JobOptions `yaml:",inline"`
+
+	// value of EESSI_SOFTWARE_SUBDIR_OVERRIDE, defaults to the cpuArchSubdir
+	SoftwareSubdirOverride string `yaml:"software_subdir_override"`
+}
+
+type SamctrConfig struct {
+	Config         string   `yaml:"config"`
+	WriteableRepos []string `yaml:"writeable_repositories"`
+	Resume         string   `yaml:"resume"`
+}
+
+// Merge returns o with the non empty values of other applied on top
+func (o JobOptions) Merge(other JobOptions) JobOptions {
+	if other.Partition != "" {
+		o.Partition = other.Partition
+	}
+	if other.Mem != "" {
+		o.Mem = other.Mem
+	}
+	if other.Time != "" {
+		o.Time = other.Time
+	}
+	if other.Cpus != "" {
+		o.Cpus = other.Cpus
+	}
+	return o
+}
+
+// JobOptions returns the slurm options for toolchain, the toolchain section
+// takes precedence over the general slurm options.
+func (c *Config) JobOptions(toolchain string) JobOptions {
+	return c.Slurm.JobOptions.Merge(c.Slurm.Toolchains[toolchain])
+}
+
+// Arch returns the matrix entry of cpuArchSubdir
+func (c *Config) Arch(cpuArchSubdir string) (Arch, error) {
+	a, ok := c.Matrix[cpuArchSubdir]
+	if !ok {
+		return a, fmt.Errorf("arch %q not in the matrix of the config, available: %s", cpuArchSubdir, strings.Join(sortedKeys(c.Matrix), ", "))
+	}
+	if a.SoftwareSubdirOverride == "" {
+		a.SoftwareSubdirOverride = cpuArchSubdir
+	}
+	return a, nil
+}
+
+// DefaultConfig returns the configuration used when no config file is found
+func DefaultConfig() *Config {
+	return &Config{
+		LmodInit:   "/opt/adm/asc-software-stack/asc-software-layer-scripts/init/lmod/bash",
+		InstallDir: "/cvmfs/software.eessi.io",
+		Modules:    []string{"EESSI/{{ .StackVer }}", "ASC/{{ .StackVer }}"},
+		Defaults:   map[string]string{},
+		Stacks:     map[string]map[string]string{},
+		Slurm: SlurmConfig{
+			Sbatch: "sbatch",
+			Squeue: "squeue",
+			Sacct:  "sacct",
+		},
+		EbCommand: "eb",
+		StateFile: DefaultStatePath(),
+	}
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/samgx/config.yaml, falling back
+// to $HOME/.config/samgx/config.yaml
+func DefaultConfigPath() string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(xdg, "samgx", "config.yaml")
+}
+
+// LoadConfig reads the config file at confPath. If confPath is empty the
+// default path is tried, a missing file there is not an error.
+func LoadConfig(confPath string) (*Config, error) {
+	config := DefaultConfig()
+	explicit := confPath != ""
+	if !explicit {
+		confPath = DefaultConfigPath()
+	}
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return config, nil
+		}
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("error decoding config %s: %w", confPath, err)
+	}
+	config.Path = confPath
+	log.Printf("Using config file: %s", confPath)
+	return config, nil
+}
+
+// resolve p relative to the directory of the config file
+func (c *Config) resolve(p string) string {
+	if p == "" || filepath.IsAbs(p) || c.Path == "" {
+		return p
+	}
+	return filepath.Join(filepath.Dir(c.Path), p)
+}
+
+// StatePath returns the path of the job state file
+func (c *Config) StatePath() string {
+	return c.resolve(c.StateFile)
+}
+
+// SearchRobotPaths returns the robot paths searched for the easyconfigs of an
+// easystack: those of the config, the robot-paths EasyBuild option of the
+// stack version and toolchain the job passes on to eb, and those in
+// $EASYBUILD_ROBOT_PATHS. ${NAME} variables in the option are expanded like
+// in the job, entries with EasyBuild templates like %(DEFAULT_ROBOT_PATHS)s
+// are skipped.
+func (c *Config) SearchRobotPaths(stackVer, toolchain string) ([]string, error) {
+	var result []string
+	for _, p := range c.RobotPaths {
+		result = append(result, c.resolve(p))
+	}
+	opts, err := c.EasyBuildOptions(stackVer, toolchain)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range opts {
+		if o.Section != "config" || o.Key != "robot-paths" {
+			continue
+		}
+		value := shellVarRe.ReplaceAllStringFunc(o.Value, func(v string) string {
+			return os.Getenv(v[2 : len(v)-1])
+		})
+		for _, p := range filepath.SplitList(value) {
+			if p != "" && !strings.Contains(p, "%(") {
+				result = append(result, p)
+			}
+		}
+	}
+	for _, p := range filepath.SplitList(os.Getenv("EASYBUILD_ROBOT_PATHS")) {
+		if p != "" {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+// OptDefaults returns the option defaults for stackver, values from the stack
+// section of the config take precedence over the general defaults.
+func (c *Config) OptDefaults(stackver string) map[string]string {
+	result := make(map[string]string)
+	for k, v := range c.Defaults {
+		result[k] = v
+	}
+	for k, v := range c.Stacks[stackver] {
+		result[k] = v
+	}
+	return result
+}
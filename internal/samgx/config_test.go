@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testConfig = `
+lmod_init: /opt/site/init/lmod/bash
+build_cmd_template: build.tmpl
+defaults:
+  stackver: "2025.06"
+  ebver: "5.2.0"
+stacks:
+  "2023.06":
+    ebver: "4.9.4"
+`
+
+func writeTestConfig(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadConfig(t *testing.T) {
+	p := writeTestConfig(t, testConfig)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(p), "build.tmpl"), []byte("eb {{ .EbVer }}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	if c.LmodInit != "/opt/site/init/lmod/bash" {
+		t.Errorf("LoadConfig got lmod_init %s", c.LmodInit)
+	}
+	if c.InstallDir != DefaultConfig().InstallDir {
+		t.Errorf("LoadConfig got install_dir %s, want the default", c.InstallDir)
+	}
+
+	var optDefaultsTests = []struct {
+		stackver string
+		ebver    string
+	}{
+		{"2023.06", "4.9.4"},
+		{"2025.06", "5.2.0"},
+	}
+	for _, e := range optDefaultsTests {
+		if got := c.OptDefaults(e.stackver)["ebver"]; got != e.ebver {
+			t.Errorf("OptDefaults(%s) got ebver %s, want %s", e.stackver, got, e.ebver)
+		}
+	}
+
+	if _, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Errorf("LoadConfig of a missing --config file succeeded")
+	}
+}
+
+func TestEasyBuildOptions(t *testing.T) {
+	p := writeTestConfig(t, `
+easybuild:
+  sourcepath: /opt/adm/sources
+  buildpath: /local/${USER}/eb
+  override.accept-eula-for: CUDA
+  stacks:
+    "2023.06":
+      buildpath: /scratch/eb
+  toolchains:
+    foss-2023b:
+      buildpath: /dev/shm/eb
+      hooks: /opt/adm/hooks.py
+`)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	var buildpathTests = []struct {
+		stackver, toolchain, buildpath string
+		count                          int
+	}{
+		{"2025.06", "foss-2025a", "/local/${USER}/eb", 3},
+		{"2023.06", "foss-2023a", "/scratch/eb", 3},
+		{"2023.06", "foss-2023b", "/dev/shm/eb", 4},
+	}
+	for _, tt := range buildpathTests {
+		opts, err := c.EasyBuildOptions(tt.stackver, tt.toolchain)
+		if err != nil {
+			t.Fatalf("EasyBuildOptions: %s", err)
+		}
+		if len(opts) != tt.count {
+			t.Errorf("EasyBuildOptions(%s, %s) got %d options, want %d", tt.stackver, tt.toolchain, len(opts), tt.count)
+		}
+		for _, o := range opts {
+			if o.Key == "buildpath" && o.Value != tt.buildpath {
+				t.Errorf("EasyBuildOptions(%s, %s) got buildpath %s, want %s", tt.stackver, tt.toolchain, o.Value, tt.buildpath)
+			}
+		}
+	}
+
+	opts, _ := c.EasyBuildOptions("2025.06", "")
+	if got := opts[0].EnvName(); got != "EASYBUILD_ACCEPT_EULA_FOR" {
+		t.Errorf("EnvName got %s", got)
+	}
+	want := "[config]\nbuildpath = /local/${USER}/eb\nsourcepath = /opt/adm/sources\n\n[override]\naccept-eula-for = CUDA\n"
+	if got := opts.Cfg(); got != want {
+		t.Errorf("Cfg got\n%s\nwant\n%s", got, want)
+	}
+
+	for _, k := range []string{"build path", "$(id)", "override.", "a.b.c", "config;x.buildpath"} {
+		c.EasyBuild.Options = map[string]string{k: "x"}
+		if _, err := c.EasyBuildOptions("2025.06", ""); err == nil {
+			t.Errorf("EasyBuildOptions accepted the option %q", k)
+		}
+	}
+	c.EasyBuild.Options = map[string]string{"buildpath": "/tmp\nEOEB\nid"}
+	if _, err := c.EasyBuildOptions("2025.06", ""); err == nil {
+		t.Errorf("EasyBuildOptions accepted a value with a newline")
+	}
+
+	c.EasyBuild.Format = "ini"
+	if _, err := c.EasyBuildFormat(); err == nil {
+		t.Errorf("EasyBuildFormat accepted %q", c.EasyBuild.Format)
+	}
+}
+
+func TestSearchRobotPaths(t *testing.T) {
+	p := writeTestConfig(t, `
+robot_paths: [easyconfigs]
+easybuild:
+  robot-paths: /opt/adm/easyconfigs:%(DEFAULT_ROBOT_PATHS)s
+  toolchains:
+    foss-2023b:
+      robot-paths: ${SAMGX_TEST_HOME}/easyconfigs:$HOME/x
+`)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	t.Setenv("SAMGX_TEST_HOME", "/home/eb")
+	t.Setenv("EASYBUILD_ROBOT_PATHS", "/env/easyconfigs")
+	configPath := filepath.Join(filepath.Dir(p), "easyconfigs")
+	var robotPathTests = []struct {
+		toolchain string
+		want      []string
+	}{
+		{"foss-2025a", []string{configPath, "/opt/adm/easyconfigs", "/env/easyconfigs"}},
+		{"foss-2023b", []string{configPath, "/home/eb/easyconfigs", "$HOME/x", "/env/easyconfigs"}},
+	}
+	for _, tt := range robotPathTests {
+		got, err := c.SearchRobotPaths("2025.06", tt.toolchain)
+		if err != nil {
+			t.Fatalf("SearchRobotPaths: %s", err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchRobotPaths(%s) got %v, want %v", tt.toolchain, got, tt.want)
+		}
+	}
+}
+
+func TestUseTarget(t *testing.T) {
+	p := writeTestConfig(t, `
+crtar_repo: software.asc.ac.at
+targets:
+  eessi:
+    install_dir: /cvmfs/software.eessi.io
+    modules: ["EESSI/{{ .StackVer }}"]
+    crtar_repo: software.eessi.io
+  project:
+    install_dir: /cvmfs/project.asc.ac.at
+`)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	if err := c.UseTarget("project"); err != nil {
+		t.Fatalf("UseTarget: %s", err)
+	}
+	modules, err := ExpandModules(c.Modules, BuildCmdData{StackVer: "2025.06"})
+	if err != nil {
+		t.Fatalf("ExpandModules: %s", err)
+	}
+	if c.InstallDir != "/cvmfs/project.asc.ac.at" || c.CrtarRepo != "software.asc.ac.at" ||
+		!reflect.DeepEqual(modules, []string{"EESSI/2025.06", "ASC/2025.06"}) {
+		t.Errorf("UseTarget(project) got %s %s %v", c.InstallDir, c.CrtarRepo, modules)
+	}
+
+	if err := c.UseTarget("eessi"); err != nil {
+		t.Fatalf("UseTarget: %s", err)
+	}
+	modules, _ = ExpandModules(c.Modules, BuildCmdData{StackVer: "2025.06"})
+	if c.CrtarRepo != "software.eessi.io" || !reflect.DeepEqual(modules, []string{"EESSI/2025.06"}) {
+		t.Errorf("UseTarget(eessi) got %s %v", c.CrtarRepo, modules)
+	}
+
+	if err := c.UseTarget("nope"); err == nil {
+		t.Errorf("UseTarget of an unknown target succeeded")
+	}
+	if _, err := ExpandModules([]string{"ASC/{{ .Nope }}"}, BuildCmdData{}); err == nil {
+		t.Errorf("ExpandModules with an unknown field succeeded")
+	}
+}
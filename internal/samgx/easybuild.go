@@ -0,0 +1,99 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EasyBuildConfig holds EasyBuild options (sourcepath, buildpath, hooks,
+// robot-paths, accept-eula-for, ...) by their long option name. The general
+// options are overridden by those of the stack version, which are overridden
+// by those of the toolchain.
+type EasyBuildConfig struct {
+	Options    map[string]string            `yaml:",inline"`
+	Stacks     map[string]map[string]string `yaml:"stacks"`
+	Toolchains map[string]map[string]string `yaml:"toolchains"`
+
+	// env (EASYBUILD_* variables, default) or cfg (easybuild.cfg file)
+	Format string `yaml:"format"`
+}
+
+// An EasyBuildOption is a long EasyBuild option. In cfg files it goes into
+// the section given as <section>.<option> in the config, [config] otherwise.
+type EasyBuildOption struct {
+	Section, Key, Value string
+}
+
+// EnvName returns the EASYBUILD_* variable of the option
+func (o EasyBuildOption) EnvName() string {
+	return "EASYBUILD_" + strings.ToUpper(strings.ReplaceAll(o.Key, "-", "_"))
+}
+
+type EasyBuildOptions []EasyBuildOption
+
+// Cfg returns the options in the format of an EasyBuild config file
+func (opts EasyBuildOptions) Cfg() string {
+	sections := make(map[string][]EasyBuildOption)
+	for _, o := range opts {
+		sections[o.Section] = append(sections[o.Section], o)
+	}
+	var b strings.Builder
+	for i, s := range sortedKeys(sections) {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", s)
+		for _, o := range sections[s] {
+			fmt.Fprintf(&b, "%s = %s\n", o.Key, o.Value)
+		}
+	}
+	return b.String()
+}
+
+// names of easybuild options and cfg sections
+var ebOptionNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// EasyBuildOptions returns the merged EasyBuild options for a stack version
+// and toolchain sorted by name
+func (c *Config) EasyBuildOptions(stackVer, toolchain string) (EasyBuildOptions, error) {
+	merged := make(map[string]string)
+	for _, m := range []map[string]string{c.EasyBuild.Options, c.EasyBuild.Stacks[stackVer], c.EasyBuild.Toolchains[toolchain]} {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	var result EasyBuildOptions
+	for _, k := range sortedKeys(merged) {
+		o := EasyBuildOption{Section: "config", Key: k, Value: merged[k]}
+		if section, key, ok := strings.Cut(k, "."); ok {
+			o.Section, o.Key = section, key
+		}
+		if !ebOptionNameRe.MatchString(o.Key) || !ebOptionNameRe.MatchString(o.Section) {
+			return nil, fmt.Errorf("configuration error: invalid easybuild option %q, want <option> or <section>.<option>", k)
+		}
+		if strings.ContainsAny(o.Value, "\r\n") {
+			return nil, fmt.Errorf("configuration error: easybuild option %s spans several lines", k)
+		}
+		result = append(result, o)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result, nil
+}
+
+// EasyBuildFormat returns the configured format, env or cfg
+func (c *Config) EasyBuildFormat() (string, error) {
+	switch c.EasyBuild.Format {
+	case "", "env":
+		return "env", nil
+	case "cfg":
+		return "cfg", nil
+	default:
+		return "", fmt.Errorf("configuration error: unknown easybuild format %q, want env or cfg", c.EasyBuild.Format)
+	}
+}
@@ -0,0 +1,181 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// An EasystackEntry is an easyconfig listed in an easystack file, together
+// with the EasyBuild options given for it (e.g. from-pr)
+type EasystackEntry struct {
+	Easyconfig string
+	Options    map[string]any
+}
+
+type Easystack struct {
+	Path        string
+	Easyconfigs []EasystackEntry
+}
+
+// EasystackPath returns the easystack of a toolchain in the git repo
+func EasystackPath(gitRepo, stackVer, ebVer, toolchain string) string {
+	name := fmt.Sprintf("asc_eb_%s-%s.yaml", ebVer, toolchain)
+	return filepath.Join(gitRepo, "easystacks", stackVer, name)
+}
+
+// ReadEasystack parses the easystack file at p. Entries are either a plain
+// easyconfig name or a map of the name to its options:
+//
+//	easyconfigs:
+//	  - GCC-13.2.0.eb
+//	  - OpenMPI-4.1.6-GCC-13.2.0.eb:
+//	      options:
+//	        from-pr: 19940
+func ReadEasystack(p string) (*Easystack, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading easystack: %w", err)
+	}
+	var raw struct {
+		Easyconfigs []yaml.Node `yaml:"easyconfigs"`
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("easystack %s is malformed: %w", p, err)
+	}
+	if len(raw.Easyconfigs) == 0 {
+		return nil, fmt.Errorf("easystack %s is malformed: no easyconfigs listed", p)
+	}
+
+	es := &Easystack{Path: p}
+	for _, n := range raw.Easyconfigs {
+		var entry EasystackEntry
+		switch n.Kind {
+		case yaml.ScalarNode:
+			entry.Easyconfig = n.Value
+		case yaml.MappingNode:
+			var m map[string]struct {
+				Options map[string]any `yaml:"options"`
+			}
+			if err := n.Decode(&m); err != nil || len(m) != 1 {
+				return nil, fmt.Errorf("easystack %s is malformed at line %d", p, n.Line)
+			}
+			for k, v := range m {
+				entry.Easyconfig = k
+				entry.Options = v.Options
+			}
+		default:
+			return nil, fmt.Errorf("easystack %s is malformed at line %d", p, n.Line)
+		}
+		if strings.TrimSpace(entry.Easyconfig) == "" {
+			return nil, fmt.Errorf("easystack %s is malformed: empty easyconfig at line %d", p, n.Line)
+		}
+		es.Easyconfigs = append(es.Easyconfigs, entry)
+	}
+	return es, nil
+}
+
+// Names returns the easyconfigs of the easystack in order
+func (es *Easystack) Names() []string {
+	var result []string
+	for _, e := range es.Easyconfigs {
+		result = append(result, e.Easyconfig)
+	}
+	return result
+}
+
+// where an easyconfig of an easystack was found
+const (
+	SourceGitRepo = "gitrepo"
+	SourceRobot   = "robot"
+	SourcePR      = "from-pr"
+)
+
+type ResolvedEasyconfig struct {
+	EasystackEntry
+	Source string // empty if not found
+	Path   string
+}
+
+var ErrEasyconfigsMissing = errors.New("easyconfigs not found")
+
+// Resolve looks up the easyconfigs of the easystack in the git repo and the
+// robot paths. Entries taken from a pull request or commit are not looked up.
+// The error wraps ErrEasyconfigsMissing if any easyconfig could not be found.
+func (es *Easystack) Resolve(gitRepo string, robotPaths []string) ([]ResolvedEasyconfig, error) {
+	repoIndex, err := IndexEasyconfigs(gitRepo)
+	if err != nil {
+		return nil, err
+	}
+	robotIndex, err := IndexEasyconfigs(robotPaths...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ResolvedEasyconfig
+	var missing []string
+	for _, e := range es.Easyconfigs {
+		r := ResolvedEasyconfig{EasystackEntry: e}
+		if pr, ok := e.Options["from-pr"]; ok {
+			r.Source, r.Path = SourcePR, fmt.Sprint(pr)
+		} else if c, ok := e.Options["from-commit"]; ok {
+			r.Source, r.Path = SourcePR, fmt.Sprint(c)
+		} else if p, ok := repoIndex[e.Easyconfig]; ok {
+			r.Source, r.Path = SourceGitRepo, p
+		} else if p, ok := robotIndex[e.Easyconfig]; ok {
+			r.Source, r.Path = SourceRobot, p
+		} else {
+			missing = append(missing, e.Easyconfig)
+		}
+		result = append(result, r)
+	}
+	if len(missing) > 0 {
+		return result, fmt.Errorf("%w in %s or robot paths: %s", ErrEasyconfigsMissing, gitRepo, strings.Join(missing, ", "))
+	}
+	return result, nil
+}
+
+// IndexEasyconfigs maps the file names of all *.eb files below roots to their
+// path, the first root containing a name wins
+func IndexEasyconfigs(roots ...string) (map[string]string, error) {
+	index := make(map[string]string)
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			log.Printf("IndexEasyconfigs skipping %s: %s", root, err)
+			continue
+		}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".eb") {
+				if _, ok := index[d.Name()]; !ok {
+					index[d.Name()] = p
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("indexing easyconfigs in %s: %w", root, err)
+		}
+	}
+	return index, nil
+}
@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testEasystack = `easyconfigs:
+  - Go-1.25.0.eb
+  - zlib-1.3.1-GCCcore-14.2.0.eb
+  - OpenMPI-5.0.7-GCC-14.2.0.eb:
+      options:
+        from-pr: 22000
+`
+
+func touch(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadEasystack(t *testing.T) {
+	repo := t.TempDir()
+	p := EasystackPath(repo, "2025.06", "5.2.0", "foss-2025a")
+	touch(t, p, testEasystack)
+
+	es, err := ReadEasystack(p)
+	if err != nil {
+		t.Fatalf("ReadEasystack: %s", err)
+	}
+	want := []string{"Go-1.25.0.eb", "zlib-1.3.1-GCCcore-14.2.0.eb", "OpenMPI-5.0.7-GCC-14.2.0.eb"}
+	if !reflect.DeepEqual(es.Names(), want) {
+		t.Errorf("ReadEasystack got %v, want %v", es.Names(), want)
+	}
+
+	var malformedTests = []string{
+		"",
+		"easyconfigs: Go-1.25.0.eb\n",
+		"easyconfigs:\n  - [Go-1.25.0.eb]\n",
+		"easyconfigs:\n  - Go-1.25.0.eb: [\n",
+	}
+	for _, m := range malformedTests {
+		touch(t, p, m)
+		if _, err := ReadEasystack(p); err == nil {
+			t.Errorf("ReadEasystack(%q) succeeded", m)
+		}
+	}
+	if _, err := ReadEasystack(filepath.Join(repo, "missing.yaml")); err == nil {
+		t.Errorf("ReadEasystack of a missing file succeeded")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	repo := t.TempDir()
+	robot := t.TempDir()
+	touch(t, filepath.Join(repo, "easyconfigs", "g", "Go", "Go-1.25.0.eb"), "")
+	touch(t, filepath.Join(repo, ".git", "zlib-1.3.1-GCCcore-14.2.0.eb"), "")
+	p := EasystackPath(repo, "2025.06", "5.2.0", "foss-2025a")
+	touch(t, p, testEasystack)
+	es, err := ReadEasystack(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := es.Resolve(repo, []string{robot})
+	if !errors.Is(err, ErrEasyconfigsMissing) {
+		t.Errorf("Resolve got %v, want ErrEasyconfigsMissing", err)
+	}
+	if resolved[1].Source != "" {
+		t.Errorf("Resolve found %s in %s", resolved[1].Easyconfig, resolved[1].Path)
+	}
+
+	touch(t, filepath.Join(robot, "z", "zlib", "zlib-1.3.1-GCCcore-14.2.0.eb"), "")
+	resolved, err = es.Resolve(repo, []string{robot})
+	if err != nil {
+		t.Fatalf("Resolve: %s", err)
+	}
+	sources := []string{resolved[0].Source, resolved[1].Source, resolved[2].Source}
+	if want := []string{SourceGitRepo, SourceRobot, SourcePR}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("Resolve got sources %v, want %v", sources, want)
+	}
+}
+
+func TestDiscoverStacks(t *testing.T) {
+	repo := t.TempDir()
+	for _, s := range []StackEasystack{
+		{"2025.06", "5.2.0", "foss-2025a", ""},
+		{"2025.06", "5.10.0", "foss-2025a", ""},
+		{"2025.06", "5.2.0", "foss-2024a", ""},
+		{"2023.06", "4.9.4", "foss-2023b", ""},
+	} {
+		touch(t, EasystackPath(repo, s.StackVer, s.EbVer, s.Toolchain), testEasystack)
+	}
+	touch(t, filepath.Join(repo, "easystacks", "2025.06", "README.md"), "")
+
+	stacks, err := DiscoverStacks(repo)
+	if err != nil {
+		t.Fatalf("DiscoverStacks: %s", err)
+	}
+	var got []string
+	for _, s := range stacks {
+		got = append(got, s.StackVer+" "+s.EbVer+" "+s.Toolchain)
+	}
+	want := []string{
+		"2023.06 4.9.4 foss-2023b",
+		"2025.06 5.2.0 foss-2024a",
+		"2025.06 5.2.0 foss-2025a",
+		"2025.06 5.10.0 foss-2025a",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiscoverStacks got %v, want %v", got, want)
+	}
+
+	var ebverTests = []struct {
+		stackver, toolchain, want string
+	}{
+		{"2025.06", "", "5.10.0"},
+		{"2025.06", "foss-2024a", "5.2.0"},
+		{"2023.06", "", "4.9.4"},
+		{"2023.06", "foss-2025a", ""},
+		{"2024.01", "", ""},
+	}
+	for _, tt := range ebverTests {
+		if got := DefaultEbVer(stacks, tt.stackver, tt.toolchain); got != tt.want {
+			t.Errorf("DefaultEbVer(%s, %s) got %q, want %q", tt.stackver, tt.toolchain, got, tt.want)
+		}
+	}
+
+	if _, err := DiscoverStacks(filepath.Join(repo, "missing")); err == nil {
+		t.Errorf("DiscoverStacks of a missing repo succeeded")
+	}
+}
+
+func TestInstallStatuses(t *testing.T) {
+	repo := t.TempDir()
+	touch(t, filepath.Join(repo, "easyconfigs", "Go-1.25.0.eb"), "name = 'Go'\nversion = '1.25.0'\ntoolchain = SYSTEM\n")
+	p := EasystackPath(repo, "2025.06", "5.2.0", "foss-2025a")
+	touch(t, p, testEasystack)
+
+	install := t.TempDir()
+	modules := ModulesDir(install, "2025.06", "x86_64/amd/zen4")
+	touch(t, filepath.Join(modules, "Go", "1.25.0.lua"), "")
+	touch(t, filepath.Join(modules, "OpenMPI", "5.0.7-GCC-14.2.0"), "")
+
+	es, err := ReadEasystack(p)
+	if err != nil {
+		t.Fatalf("ReadEasystack: %s", err)
+	}
+	resolved, _ := es.Resolve(repo, nil)
+	statuses, err := InstallStatuses(resolved, modules)
+	if err != nil {
+		t.Fatalf("InstallStatuses: %s", err)
+	}
+	var got []string
+	for _, s := range statuses {
+		got = append(got, fmt.Sprintf("%s %t", s.Module, s.Installed))
+	}
+	want := []string{"Go/1.25.0 true", "zlib/1.3.1-GCCcore-14.2.0 false", "OpenMPI/5.0.7-GCC-14.2.0 true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InstallStatuses got %v, want %v", got, want)
+	}
+	if _, err := InstallStatuses(resolved, filepath.Join(install, "missing")); err == nil {
+		t.Errorf("InstallStatuses with a missing modules dir succeeded")
+	}
+
+	// the filtered easystack keeps the options of its entries
+	missing := es.Filter(func(e EasystackEntry) bool { return e.Easyconfig != "Go-1.25.0.eb" })
+	data, err := missing.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal: %s", err)
+	}
+	touch(t, p, string(data))
+	es, err = ReadEasystack(p)
+	if err != nil {
+		t.Fatalf("ReadEasystack of the filtered easystack: %s", err)
+	}
+	if !reflect.DeepEqual(es.Easyconfigs, missing.Easyconfigs) {
+		t.Errorf("filtered easystack got %+v, want %+v", es.Easyconfigs, missing.Easyconfigs)
+	}
+}
@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/asc-ac-at/sam/internal/crtar"
+	"go.yaml.in/yaml/v3"
+)
+
+// ModulesDir returns the directory holding the modules of a stack version and
+// arch below installDir
+func ModulesDir(installDir, stackVer, cpuArchSubdir string) string {
+	return filepath.Join(installDir, "versions", stackVer, "software", "linux", cpuArchSubdir, "modules", "all")
+}
+
+// An InstallStatus tells whether the module of an easyconfig exists
+type InstallStatus struct {
+	ResolvedEasyconfig
+	Module    string
+	Installed bool
+}
+
+// <name>-<version>..., the name ends before the first "-<digit>"
+var ecFileNameRe = regexp.MustCompile(`^(.+?)-(\d.*)$`)
+
+// ModuleName returns the module <name>/<version> EasyBuild installs for an
+// easyconfig. The name is taken from the easyconfig file at p if there is
+// one, otherwise it is guessed from the file name.
+func ModuleName(easyconfig, p string) string {
+	base := strings.TrimSuffix(easyconfig, ".eb")
+	var ec *crtar.Easyconfig
+	if data, err := os.ReadFile(p); err == nil {
+		ec = crtar.ParseEasyconfig(string(data))
+	}
+	if ec != nil {
+		if ec.Name != "" && strings.HasPrefix(base, ec.Name+"-") {
+			return ec.Name + "/" + strings.TrimPrefix(base, ec.Name+"-")
+		}
+		if ec.Name != "" && ec.Version != "" {
+			version := ec.Version
+			if ec.ToolchainName != "" && ec.ToolchainName != "system" {
+				version += "-" + ec.ToolchainName + "-" + ec.ToolchainVersion
+			}
+			return ec.Name + "/" + version + ec.VersionSuffix
+		}
+	}
+	if m := ecFileNameRe.FindStringSubmatch(base); m != nil {
+		return m[1] + "/" + m[2]
+	}
+	return base
+}
+
+// moduleInstalled reports whether modulesDir holds a lua or tcl module file
+func moduleInstalled(modulesDir, module string) bool {
+	for _, p := range []string{module + ".lua", module} {
+		if fi, err := os.Stat(filepath.Join(modulesDir, p)); err == nil && !fi.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallStatuses looks up the modules of the resolved easyconfigs in
+// modulesDir
+func InstallStatuses(resolved []ResolvedEasyconfig, modulesDir string) ([]InstallStatus, error) {
+	if _, err := os.Stat(modulesDir); err != nil {
+		return nil, fmt.Errorf("cannot check installed modules: %w", err)
+	}
+	var result []InstallStatus
+	for _, r := range resolved {
+		p := ""
+		if r.Source == SourceGitRepo || r.Source == SourceRobot {
+			p = r.Path
+		}
+		s := InstallStatus{ResolvedEasyconfig: r, Module: ModuleName(r.Easyconfig, p)}
+		s.Installed = moduleInstalled(modulesDir, s.Module)
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+// Filter returns a copy of the easystack with the entries keep returns true
+// for
+func (es *Easystack) Filter(keep func(EasystackEntry) bool) *Easystack {
+	result := &Easystack{Path: es.Path}
+	for _, e := range es.Easyconfigs {
+		if keep(e) {
+			result.Easyconfigs = append(result.Easyconfigs, e)
+		}
+	}
+	return result
+}
+
+// Marshal encodes the easystack in the format ReadEasystack reads
+func (es *Easystack) Marshal() ([]byte, error) {
+	var entries []any
+	for _, e := range es.Easyconfigs {
+		if len(e.Options) == 0 {
+			entries = append(entries, e.Easyconfig)
+			continue
+		}
+		entries = append(entries, map[string]any{
+			e.Easyconfig: map[string]any{"options": e.Options},
+		})
+	}
+	data, err := yaml.Marshal(map[string]any{"easyconfigs": entries})
+	if err != nil {
+		return nil, fmt.Errorf("encoding easystack: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,218 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A SubmittedJob is recorded in the state file by samgx submit
+type SubmittedJob struct {
+	JobID      string    `json:"job_id"`
+	JobName    string    `json:"job_name"`
+	Recipe     string    `json:"recipe"`
+	StackVer   string    `json:"stackver"`
+	Toolchain  string    `json:"toolchain,omitempty"`
+	Easystack  string    `json:"easystack,omitempty"`
+	Easyconfig string    `json:"easyconfig,omitempty"`
+	GitRepo    string    `json:"gitrepo,omitempty"`
+	GitCommit  string    `json:"git_commit,omitempty"`
+	Submitted  time.Time `json:"submitted"`
+
+	// jobs submitted together by samgx chain share the chain name, After
+	// holds the ids of the jobs this one depends on
+	Chain string   `json:"chain,omitempty"`
+	After []string `json:"after,omitempty"`
+}
+
+// JobState is the list of jobs submitted by samgx
+type JobState struct {
+	Jobs []SubmittedJob `json:"jobs"`
+
+	// file the state was read from
+	Path string `json:"-"`
+}
+
+// DefaultStatePath returns $XDG_STATE_HOME/samgx/jobs.json, falling back to
+// $HOME/.local/state/samgx/jobs.json
+func DefaultStatePath() string {
+	xdg := os.Getenv("XDG_STATE_HOME")
+	if xdg == "" {
+		xdg = filepath.Join(os.Getenv("HOME"), ".local", "state")
+	}
+	return filepath.Join(xdg, "samgx", "jobs.json")
+}
+
+// LoadJobState reads the state file at p, a missing file is an empty state
+func LoadJobState(p string) (*JobState, error) {
+	s := &JobState{Path: p}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading job state: %w", err)
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("decoding job state %s: %w", p, err)
+	}
+	return s, nil
+}
+
+// how long Add waits for the lock of the state file
+var stateLockTimeout = 10 * time.Second
+
+// Add records job and saves the state. The state file is locked with
+// <path>.lock and read again first, so jobs added by samgx runs since the
+// state was loaded are kept.
+func (s *JobState) Add(job SubmittedJob) error {
+	unlock, err := lockState(s.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := LoadJobState(s.Path)
+	if err != nil {
+		return err
+	}
+	s.Jobs = append(current.Jobs, job)
+	return s.Save()
+}
+
+// lockState creates the lockfile of the state file p, waiting for another
+// samgx to remove it for up to stateLockTimeout. It returns the function
+// removing the lockfile.
+func lockState(p string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return nil, fmt.Errorf("creating job state dir: %w", err)
+	}
+	lock := p + ".lock"
+	deadline := time.Now().Add(stateLockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("locking job state: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("job state %s is locked by %s, remove it if no samgx is running", p, lock)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Save writes the state file, replacing it atomically
+func (s *JobState) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding job state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("creating job state dir: %w", err)
+	}
+	tmp := s.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing job state %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, s.Path)
+}
+
+// Submit passes the job script to sbatch on stdin and returns the job id.
+// sbatch is the command to run (e.g. ["sbatch"] or a fake for testing),
+// --parsable is appended to it.
+func Submit(sbatch []string, script io.Reader) (string, error) {
+	if len(sbatch) == 0 {
+		return "", fmt.Errorf("no sbatch command configured")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(sbatch[0], append(sbatch[1:], "--parsable")...)
+	cmd.Stdin = script
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w: %s", sbatch[0], err, strings.TrimSpace(stderr.String()))
+	}
+	// <jobid>[;<cluster>]
+	id, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), ";")
+	if id == "" {
+		return "", fmt.Errorf("%s returned no job id", sbatch[0])
+	}
+	return id, nil
+}
+
+// GitCommit returns the commit checked out in repo, empty if it cannot be
+// determined
+func GitCommit(repo string) string {
+	if repo == "" {
+		return ""
+	}
+	out, err := exec.Command("git", "-C", repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		log.Printf("cannot determine git commit of %s: %s", repo, err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// JobStates returns the slurm state of the jobs by id. Jobs still known to
+// squeue are taken from there, the others from sacct. Jobs neither knows
+// about are left out.
+func JobStates(squeue, sacct []string, ids []string) (map[string]string, error) {
+	states := make(map[string]string)
+	if len(ids) == 0 {
+		return states, nil
+	}
+	jobs := strings.Join(ids, ",")
+	if len(squeue) > 0 {
+		out, err := exec.Command(squeue[0], append(squeue[1:], "-h", "-o", "%i %T", "-j", jobs)...).Output()
+		if err != nil {
+			// squeue fails if none of the jobs is queued any more
+			log.Printf("%s: %s", squeue[0], err)
+		}
+		parseStates(states, string(out), " ")
+	}
+	var done []string
+	for _, id := range ids {
+		if _, ok := states[id]; !ok {
+			done = append(done, id)
+		}
+	}
+	if len(done) == 0 || len(sacct) == 0 {
+		return states, nil
+	}
+	out, err := exec.Command(sacct[0], append(sacct[1:], "-n", "-P", "-X", "-o", "JobID,State", "-j", strings.Join(done, ","))...).Output()
+	if err != nil {
+		return states, fmt.Errorf("%s failed: %w", sacct[0], err)
+	}
+	parseStates(states, string(out), "|")
+	return states, nil
+}
+
+// parse "<id><sep><state>" lines, sacct reports e.g. "CANCELLED by 1234"
+func parseStates(states map[string]string, out, sep string) {
+	for _, line := range strings.Split(out, "\n") {
+		id, state, ok := strings.Cut(strings.TrimSpace(line), sep)
+		if !ok {
+			continue
+		}
+		if f := strings.Fields(state); len(f) > 0 {
+			states[id] = f[0]
+		}
+	}
+}
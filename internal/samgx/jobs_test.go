@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+// fakeCmd writes an executable shell script to dir and returns its path
+func fakeCmd(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSubmit(t *testing.T) {
+	dir := t.TempDir()
+	// records its arguments and stdin like sbatch would receive them
+	sbatch := fakeCmd(t, dir, "sbatch", `echo "$@" >"$(dirname "$0")/args"
+cat >"$(dirname "$0")/script"
+echo "4242;cluster"
+`)
+	id, err := Submit([]string{sbatch, "--account", "p71"}, strings.NewReader("#!/bin/bash\n"))
+	if err != nil {
+		t.Fatalf("Submit: %s", err)
+	}
+	if id != "4242" {
+		t.Errorf("Submit got job id %q, want 4242", id)
+	}
+	args, _ := os.ReadFile(filepath.Join(dir, "args"))
+	if string(args) != "--account p71 --parsable\n" {
+		t.Errorf("sbatch called with %q", args)
+	}
+	script, _ := os.ReadFile(filepath.Join(dir, "script"))
+	if string(script) != "#!/bin/bash\n" {
+		t.Errorf("sbatch got script %q", script)
+	}
+
+	failing := fakeCmd(t, dir, "failing", "echo 'invalid partition' >&2\nexit 1\n")
+	if _, err := Submit([]string{failing}, strings.NewReader("")); err == nil || !strings.Contains(err.Error(), "invalid partition") {
+		t.Errorf("Submit with failing sbatch got %v", err)
+	}
+}
+
+func TestJobState(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "samgx", "jobs.json")
+	state, err := LoadJobState(p)
+	if err != nil || len(state.Jobs) != 0 {
+		t.Fatalf("LoadJobState of a missing file got %v, %v", state, err)
+	}
+	job := SubmittedJob{
+		JobID:     "4242",
+		JobName:   "foss-foss-2025a",
+		Recipe:    "easystack",
+		StackVer:  "2025.06",
+		Toolchain: "foss-2025a",
+		Easystack: "/repo/easystacks/2025.06/asc_eb_5.2.0-foss-2025a.yaml",
+		GitCommit: "0123456789abcdef",
+		Submitted: time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := state.Add(job); err != nil {
+		t.Fatalf("Add: %s", err)
+	}
+	state, err = LoadJobState(p)
+	if err != nil {
+		t.Fatalf("LoadJobState: %s", err)
+	}
+	if !reflect.DeepEqual(state.Jobs, []SubmittedJob{job}) {
+		t.Errorf("LoadJobState got %+v", state.Jobs)
+	}
+
+	// states loaded before the others added their job
+	var states []*JobState
+	for i := 0; i < 8; i++ {
+		s, err := LoadJobState(p)
+		if err != nil {
+			t.Fatalf("LoadJobState: %s", err)
+		}
+		states = append(states, s)
+	}
+	var wg sync.WaitGroup
+	for i, s := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Add(SubmittedJob{JobID: fmt.Sprint(5000 + i)}); err != nil {
+				t.Errorf("Add: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	state, _ = LoadJobState(p)
+	if len(state.Jobs) != 1+len(states) {
+		t.Errorf("concurrent Add kept %d of %d jobs", len(state.Jobs), 1+len(states))
+	}
+
+	defer func(d time.Duration) { stateLockTimeout = d }(stateLockTimeout)
+	stateLockTimeout = 100 * time.Millisecond
+	if err := os.WriteFile(p+".lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Add(job); err == nil || !strings.Contains(err.Error(), "locked") {
+		t.Errorf("Add with a stale lock got %v", err)
+	}
+}
+
+func TestJobStates(t *testing.T) {
+	dir := t.TempDir()
+	squeue := fakeCmd(t, dir, "squeue", "echo '11 RUNNING'\necho '12 PENDING'\n")
+	sacct := fakeCmd(t, dir, "sacct", "echo '13|COMPLETED'\necho '14|CANCELLED by 1000'\n")
+	states, err := JobStates([]string{squeue}, []string{sacct}, []string{"11", "12", "13", "14", "15"})
+	if err != nil {
+		t.Fatalf("JobStates: %s", err)
+	}
+	want := map[string]string{"11": "RUNNING", "12": "PENDING", "13": "COMPLETED", "14": "CANCELLED"}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("JobStates got %v, want %v", states, want)
+	}
+}
+
+func TestOrderStages(t *testing.T) {
+	var orderTests = []struct {
+		args []string
+		want []string // nil if an error is expected
+	}{
+		{[]string{"foss-2023b", "cuda-2023b:foss-2023b"}, []string{"foss-2023b", "cuda-2023b"}},
+		{[]string{"app-2023b:cuda-2023b,foss-2023b", "cuda-2023b:foss-2023b", "foss-2023b"}, []string{"foss-2023b", "cuda-2023b", "app-2023b"}},
+		{[]string{"foss-2023a", "foss-2023b"}, []string{"foss-2023a", "foss-2023b"}},
+		{[]string{"a:b", "b:a"}, nil},
+		{[]string{"a:c"}, nil},
+		{[]string{"a", "a"}, nil},
+	}
+	for _, tt := range orderTests {
+		var stages []Stage
+		for _, a := range tt.args {
+			s, err := ParseStage(a)
+			if err != nil {
+				t.Fatalf("ParseStage(%q): %s", a, err)
+			}
+			stages = append(stages, s)
+		}
+		ordered, err := OrderStages(stages)
+		if tt.want == nil {
+			if err == nil {
+				t.Errorf("OrderStages(%v) succeeded", tt.args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("OrderStages(%v): %s", tt.args, err)
+			continue
+		}
+		var got []string
+		for _, s := range ordered {
+			got = append(got, s.Key())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OrderStages(%v) got %v, want %v", tt.args, got, tt.want)
+		}
+	}
+	if _, err := ParseStage(":foss-2023b"); err == nil {
+		t.Errorf("ParseStage without toolchain succeeded")
+	}
+}
+
+func TestChainState(t *testing.T) {
+	var stateTests = []struct {
+		states []string
+		want   string
+	}{
+		{[]string{"COMPLETED", "COMPLETED"}, "COMPLETED"},
+		{[]string{"COMPLETED", "RUNNING", "PENDING"}, "RUNNING"},
+		{[]string{"PENDING", "PENDING"}, "PENDING"},
+		{[]string{"FAILED", "CANCELLED"}, "FAILED"},
+		{[]string{"COMPLETED", "UNKNOWN"}, "RUNNING"},
+	}
+	for _, tt := range stateTests {
+		if got := ChainState(tt.states); got != tt.want {
+			t.Errorf("ChainState(%v) got %s, want %s", tt.states, got, tt.want)
+		}
+	}
+	want := []string{"--dependency=afterok:11:12", "--kill-on-invalid-dep=yes"}
+	if got := DependencyArgs([]string{"11", "12"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("DependencyArgs got %v, want %v", got, want)
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "asc_eb_5.2.0-foss-2025a.yaml")
+	if err := os.WriteFile(p, []byte(testEasystack), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prov, err := NewProvenance("v1.2.0", map[string]string{"toolchain": "foss-2025a", "ebopts": ""}, "", p)
+	if err != nil {
+		t.Fatalf("NewProvenance: %s", err)
+	}
+	prov.Generated = time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	sum, _ := util.FileSHA256(p)
+	want := "#!/usr/bin/env bash\n" +
+		"# generated by samgx v1.2.0 at 2026-02-01T12:00:00Z\n" +
+		"#   ebopts:\n" +
+		"#   toolchain: foss-2025a\n" +
+		"# easystack: " + p + "\n" +
+		"# easystack sha256: " + sum + "\n" +
+		"\neb -r\n"
+	if got := prov.AddHeader("#!/usr/bin/env bash\n\neb -r\n"); got != want {
+		t.Errorf("AddHeader got\n%s\nwant\n%s", got, want)
+	}
+
+	// a line break in a value must not end the comment
+	prov.Params = map[string]string{"ebopts": "--robot\ntouch /tmp/x"}
+	header := prov.Header()
+	if want := "#   ebopts: \"--robot\\ntouch /tmp/x\"\n"; !strings.Contains(header, want) {
+		t.Errorf("Header got\n%s\nwant a line %q", header, want)
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(header, "\n"), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			t.Errorf("Header has the line %q outside the comment", line)
+		}
+	}
+
+	if _, err := NewProvenance("v1.2.0", nil, "", p+".missing"); err == nil {
+		t.Errorf("NewProvenance with a missing easystack succeeded")
+	}
+}
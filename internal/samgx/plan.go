@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/asc-ac-at/sam/internal/crtar"
+)
+
+// A Plan is the resolved input of a build command (samgx -format json). It
+// can be edited and passed back to samgx with -plan to render it.
+type Plan struct {
+	// resolved options by name, including the recipe
+	Params map[string]string `json:"params"`
+
+	LmodInit   string   `json:"lmod_init"`
+	InstallDir string   `json:"install_dir"`
+	Modules    []string `json:"modules,omitempty"`
+
+	// easystack of the git repo and its easyconfigs, empty for recipes
+	// building single easyconfigs. The easystack is derived from the options,
+	// a plan naming another one is rejected.
+	Easystack   string           `json:"easystack,omitempty"`
+	Easyconfigs []PlanEasyconfig `json:"easyconfigs,omitempty"`
+
+	// arguments of the crtar call, ${TS} is the time the build finished.
+	// Derived from the options and the config, see CheckDerived.
+	Crtar []string `json:"crtar,omitempty"`
+
+	// pattern of the name of the tarball crtar creates: ${TS} is replaced
+	// by the time the build finished, <timestamp> by the time crtar runs.
+	// Derived like Crtar.
+	Tarball string `json:"tarball,omitempty"`
+}
+
+type PlanEasyconfig struct {
+	Easyconfig string         `json:"easyconfig"`
+	Options    map[string]any `json:"options,omitempty"`
+
+	// where the easyconfig was found, not read back
+	Source string `json:"source,omitempty"`
+	Path   string `json:"path,omitempty"`
+}
+
+// NewPlan collects the plan of a build. The crtar call is rendered from the
+// "crtar" partial if the recipe uses it.
+func NewPlan(lib *Library, r *Recipe, params map[string]string, data BuildCmdData, es *Easystack, resolved []ResolvedEasyconfig) (*Plan, error) {
+	p := &Plan{
+		Params:     params,
+		LmodInit:   data.LmodInit,
+		InstallDir: data.InstallDir,
+		Modules:    data.Modules,
+	}
+	if es != nil {
+		p.Easystack = es.Path
+		for _, r := range resolved {
+			p.Easyconfigs = append(p.Easyconfigs, PlanEasyconfig{
+				Easyconfig: r.Easyconfig,
+				Options:    r.Options,
+				Source:     r.Source,
+				Path:       r.Path,
+			})
+		}
+	}
+	if slices.Contains(r.Partials, "crtar") {
+		var out bytes.Buffer
+		if err := lib.RenderPartial(&out, "crtar", data); err != nil {
+			return nil, err
+		}
+		words, err := SplitWords(out.String())
+		if err != nil {
+			return nil, fmt.Errorf("crtar call of recipe %s: %w", r.Name, err)
+		}
+		p.Crtar = words
+		arch := data.CpuArchSubdir
+		if arch == "" {
+			arch = crtar.DefaultCpuArchSubdir
+		}
+		p.Tarball = crtar.TarballName(arch, data.ArchiveName+"-${TS}", "<timestamp>")
+	}
+	return p, nil
+}
+
+// Write encodes the plan as indented json
+func (p *Plan) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	// keep the <timestamp> of the tarball readable
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(p); err != nil {
+		return fmt.Errorf("encoding plan: %w", err)
+	}
+	return nil
+}
+
+// ReadPlan reads a plan from the file p, "-" reads stdin
+func ReadPlan(p string) (*Plan, error) {
+	var data []byte
+	var err error
+	if p == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading plan: %w", err)
+	}
+	plan := &Plan{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(plan); err != nil {
+		return nil, fmt.Errorf("decoding plan %s: %w", p, err)
+	}
+	return plan, nil
+}
+
+// CheckDerived compares the fields samgx derives from the options and the
+// config (easystack, crtar and tarball) with those of derived, the plan
+// computed for the same build. Fields left out of p are not compared. Editing
+// them has no effect, so a plan whose derived fields differ is an error.
+func (p *Plan) CheckDerived(derived *Plan) error {
+	var diffs []string
+	if p.Easystack != "" && p.Easystack != derived.Easystack {
+		diffs = append(diffs, fmt.Sprintf("easystack %s, samgx uses %s", p.Easystack, derived.Easystack))
+	}
+	if p.Crtar != nil && !slices.Equal(p.Crtar, derived.Crtar) {
+		diffs = append(diffs, fmt.Sprintf("crtar call %q, samgx renders %q", p.Crtar, derived.Crtar))
+	}
+	if p.Tarball != "" && p.Tarball != derived.Tarball {
+		diffs = append(diffs, fmt.Sprintf("tarball %s, samgx derives %s", p.Tarball, derived.Tarball))
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("the plan has %s: change the options instead or leave the field out", strings.Join(diffs, "; "))
+	}
+	return nil
+}
+
+// EasystackOf returns the easyconfigs of the plan as an easystack, nil if the
+// plan lists none
+func (p *Plan) EasystackOf(path string) *Easystack {
+	if len(p.Easyconfigs) == 0 {
+		return nil
+	}
+	es := &Easystack{Path: path}
+	for _, e := range p.Easyconfigs {
+		es.Easyconfigs = append(es.Easyconfigs, EasystackEntry{Easyconfig: e.Easyconfig, Options: e.Options})
+	}
+	return es
+}
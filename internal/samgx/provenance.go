@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+// Provenance records how a script was generated, it is written as a comment
+// block at the top of the script
+type Provenance struct {
+	Version   string
+	Generated time.Time
+
+	// resolved options by name
+	Params map[string]string
+
+	GitRepo, GitCommit string
+	GitDirty           bool
+
+	Easystack, EasystackSHA256 string
+}
+
+// NewProvenance collects the git state of gitRepo and the checksum of
+// easystack (if not empty)
+func NewProvenance(version string, params map[string]string, gitRepo, easystack string) (*Provenance, error) {
+	p := &Provenance{
+		Version:   version,
+		Generated: time.Now().UTC(),
+		Params:    params,
+		GitRepo:   gitRepo,
+		Easystack: easystack,
+	}
+	if gitRepo != "" {
+		p.GitCommit = GitCommit(gitRepo)
+		p.GitDirty = GitDirty(gitRepo)
+	}
+	if easystack != "" {
+		sum, err := util.FileSHA256(easystack)
+		if err != nil {
+			return nil, err
+		}
+		p.EasystackSHA256 = sum
+	}
+	return p, nil
+}
+
+// Header returns the provenance as bash comment lines
+func (p *Provenance) Header() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# generated by samgx %s at %s\n", p.Version, p.Generated.Format(time.RFC3339))
+	for _, k := range sortedKeys(p.Params) {
+		fmt.Fprintf(&b, "#   %s:", k)
+		if v := p.Params[k]; v != "" {
+			fmt.Fprintf(&b, " %s", commentValue(v))
+		}
+		b.WriteString("\n")
+	}
+	if p.GitRepo != "" {
+		commit := p.GitCommit
+		if commit == "" {
+			commit = "unknown"
+		}
+		if p.GitDirty {
+			commit += " (dirty)"
+		}
+		fmt.Fprintf(&b, "# git commit: %s\n", commit)
+	}
+	if p.Easystack != "" {
+		fmt.Fprintf(&b, "# easystack: %s\n", commentValue(p.Easystack))
+		fmt.Fprintf(&b, "# easystack sha256: %s\n", p.EasystackSHA256)
+	}
+	return b.String()
+}
+
+// commentValue returns v for a comment line, values with line breaks or other
+// control characters are written as a Go quoted string so they cannot end the
+// comment
+func commentValue(v string) string {
+	for _, r := range v {
+		if unicode.IsControl(r) {
+			return strconv.Quote(v)
+		}
+	}
+	return v
+}
+
+// AddHeader inserts the provenance header into script, after the #! line
+func (p *Provenance) AddHeader(script string) string {
+	if strings.HasPrefix(script, "#!") {
+		first, rest, _ := strings.Cut(script, "\n")
+		return first + "\n" + p.Header() + rest
+	}
+	return p.Header() + script
+}
+
+// GitDirty reports whether the work tree of repo has uncommitted changes
+func GitDirty(repo string) bool {
+	out, err := exec.Command("git", "-C", repo, "status", "--porcelain").Output()
+	return err == nil && len(strings.TrimSpace(string(out))) > 0
+}
@@ -0,0 +1,128 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// functions available in recipes and partials
+var templateFuncs = template.FuncMap{
+	"quote":    Quote,
+	"quoteAll": QuoteAll,
+	"dquote":   DoubleQuote,
+	"heredoc":  Heredoc,
+}
+
+// words that need no quoting in bash
+var shellSafeRe = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Quote returns s as a single bash word, values that need it are put in
+// single quotes
+func Quote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// QuoteAll quotes every element of args and joins them with spaces
+func QuoteAll(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = Quote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// variables expanded in DoubleQuote and Heredoc, only the ${NAME} form
+var shellVarRe = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+
+// DoubleQuote puts s in double quotes, variables like ${TMPDIR} in s are
+// expanded by bash. Any other $ is escaped, so $(...) is not run.
+func DoubleQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`", "$", `\$`)
+	return `"` + keepVars(s, r) + `"`
+}
+
+// Heredoc escapes s for the body of an unquoted heredoc, variables like
+// ${TMPDIR} are expanded like in DoubleQuote
+func Heredoc(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "`", "\\`", "$", `\$`)
+	return keepVars(s, r)
+}
+
+// keepVars replaces the parts of s around ${NAME} variables with r
+func keepVars(s string, r *strings.Replacer) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range shellVarRe.FindAllStringIndex(s, -1) {
+		b.WriteString(r.Replace(s[last:m[0]]))
+		b.WriteString(s[m[0]:m[1]])
+		last = m[1]
+	}
+	b.WriteString(r.Replace(s[last:]))
+	return b.String()
+}
+
+// SplitWords splits s into words the way a (POSIX) shell would, without any
+// expansions. Single and double quotes and backslash escapes are honoured.
+func SplitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\\':
+			inWord = true
+			if i+1 < len(s) {
+				i++
+				word.WriteByte(s[i])
+			}
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote in %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				// inside double quotes backslash only escapes these
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\"\\$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote in %q", s)
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,384 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// built in recipes and partials
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+const DefaultRecipe = "easystack"
+
+// BuildCmdData is passed to the recipe templates. Recipes are plain
+// text/template, values have to be quoted with the quote and quoteAll
+// functions when they are used in bash.
+type BuildCmdData struct {
+	StackVer, Name, Toolchain, EbVer, GitRepo, Easyconfig string
+	LmodInit, InstallDir                                  string
+
+	// extra EasyBuild arguments, one element per argument
+	EbOpts []string
+
+	// site EasyBuild configuration, rendered as EASYBUILD_* variables or
+	// easybuild.cfg (EasyBuildFormat env or cfg)
+	EasyBuild       EasyBuildOptions
+	EasyBuildFormat string
+
+	// name passed to crtar: <name>-<toolchain> for easystacks, <name> otherwise
+	ArchiveName string
+
+	// set when building for one arch of the matrix
+	CpuArchSubdir, SoftwareSubdirOverride string
+
+	// easystack to build instead of the one in the git repo (yaml), used to
+	// build only the easyconfigs that are not installed yet
+	EasystackYAML string
+
+	// modules loaded before EESSI-extend and the cvmfs repository passed to
+	// crtar, from the install target
+	Modules   []string
+	CrtarRepo string
+}
+
+// ExpandModules executes the module name templates of a target with data
+func ExpandModules(modules []string, data BuildCmdData) ([]string, error) {
+	var result []string
+	for _, m := range modules {
+		t, err := template.New("module").Parse(m)
+		if err != nil {
+			return nil, fmt.Errorf("configuration error: module %q: %w", m, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("configuration error: module %q: %w", m, err)
+		}
+		result = append(result, b.String())
+	}
+	return result, nil
+}
+
+// JobData is passed to the "sbatch" partial that wraps a rendered build
+// command into a slurm job script
+type JobData struct {
+	JobOptions
+	JobName string
+
+	// samctr options
+	SamctrConfig, WriteableRepos, Resume string
+
+	// rendered build command
+	BuildCmd string
+}
+
+// template fields that are filled from command line options
+var optionFields = map[string]string{
+	"StackVer":   "stackver",
+	"Name":       "name",
+	"Toolchain":  "toolchain",
+	"EbVer":      "ebver",
+	"GitRepo":    "gitrepo",
+	"EbOpts":     "ebopts",
+	"Easyconfig": "easyconfig",
+
+	// derived from options
+	"ArchiveName": "name",
+	"Modules":     "stackver",
+}
+
+// options that may be left empty even if a recipe uses them
+var optionalOptions = map[string]bool{
+	"ebopts": true,
+}
+
+// A Recipe is a named build command template.
+// Its description is taken from a leading {{/* comment */}}.
+type Recipe struct {
+	Name        string
+	Description string
+	Source      string
+
+	// file the recipe was read from, empty for built in recipes
+	Path string
+
+	// options the recipe needs, computed by the library
+	Required []string
+
+	// partials included by the recipe
+	Partials []string
+}
+
+// UsesEasystack reports whether the recipe builds the easystack of the git
+// repo (it includes the stack_file partial)
+func (r *Recipe) UsesEasystack() bool {
+	return slices.Contains(r.Partials, "stack_file")
+}
+
+// A Library holds the recipes and the partials ({{ define "name" }}) they
+// share. Files whose name starts with "_" are partials.
+type Library struct {
+	recipes  map[string]*Recipe
+	partials map[string]string
+}
+
+var descriptionRe = regexp.MustCompile(`^\{\{-?\s*/\*\s*(.*?)\s*\*/`)
+
+// LoadLibrary reads the built in recipes, then the template_dir of the config
+// and finally build_cmd_template, later ones replace recipes of the same name.
+func LoadLibrary(config *Config) (*Library, error) {
+	lib := &Library{
+		recipes:  make(map[string]*Recipe),
+		partials: make(map[string]string),
+	}
+	if err := lib.addFS(builtinTemplates, "templates", ""); err != nil {
+		return nil, err
+	}
+	if config.TemplateDir != "" {
+		dir := config.resolve(config.TemplateDir)
+		if err := lib.addFS(os.DirFS(dir), ".", dir); err != nil {
+			return nil, err
+		}
+	}
+	if config.BuildCmdTemplate != "" {
+		p := config.resolve(config.BuildCmdTemplate)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("reading build command template: %w", err)
+		}
+		lib.add(DefaultRecipe, string(data), p)
+	}
+	for _, r := range lib.recipes {
+		t, err := lib.parse(r.Name)
+		if err != nil {
+			return nil, err
+		}
+		r.Required, r.Partials = requiredOptions(t, r.Name)
+	}
+	return lib, nil
+}
+
+func (lib *Library) addFS(fsys fs.FS, dir, hostDir string) error {
+	matches, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	for _, m := range matches {
+		data, err := fs.ReadFile(fsys, m)
+		if err != nil {
+			return fmt.Errorf("reading template %s: %w", m, err)
+		}
+		name := strings.TrimSuffix(path.Base(m), ".tmpl")
+		p := ""
+		if hostDir != "" {
+			p = filepath.Join(hostDir, path.Base(m))
+		}
+		if strings.HasPrefix(name, "_") {
+			lib.partials[name] = string(data)
+			continue
+		}
+		lib.add(name, string(data), p)
+	}
+	return nil
+}
+
+func (lib *Library) add(name, src, p string) {
+	r := &Recipe{Name: name, Source: src, Path: p}
+	if m := descriptionRe.FindStringSubmatch(src); m != nil {
+		r.Description = m[1]
+	}
+	lib.recipes[name] = r
+}
+
+// Recipes returns all recipes sorted by name
+func (lib *Library) Recipes() []*Recipe {
+	var result []*Recipe
+	for _, name := range sortedKeys(lib.recipes) {
+		result = append(result, lib.recipes[name])
+	}
+	return result
+}
+
+// Recipe looks up a recipe by name
+func (lib *Library) Recipe(name string) (*Recipe, error) {
+	r, ok := lib.recipes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown recipe %q, available: %s", name, strings.Join(sortedKeys(lib.recipes), ", "))
+	}
+	return r, nil
+}
+
+// new template holding all partials
+func (lib *Library) newTemplate(name string) (*template.Template, error) {
+	t := template.New(name).Funcs(templateFuncs)
+	for _, p := range sortedKeys(lib.partials) {
+		if _, err := t.New(p).Parse(lib.partials[p]); err != nil {
+			return nil, fmt.Errorf("parsing partial %s: %w", p, err)
+		}
+	}
+	return t, nil
+}
+
+// parse the recipe together with all partials
+func (lib *Library) parse(name string) (*template.Template, error) {
+	r, err := lib.Recipe(name)
+	if err != nil {
+		return nil, err
+	}
+	t, err := lib.newTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.Parse(r.Source); err != nil {
+		return nil, fmt.Errorf("parsing recipe %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// Render executes the recipe name with data
+func (lib *Library) Render(w io.Writer, name string, data BuildCmdData) error {
+	t, err := lib.parse(name)
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, data)
+}
+
+// RenderPartial executes the partial name with data
+func (lib *Library) RenderPartial(w io.Writer, name string, data any) error {
+	t, err := lib.newTemplate(name)
+	if err != nil {
+		return err
+	}
+	return t.ExecuteTemplate(w, name, data)
+}
+
+// values of #SBATCH directives, sbatch takes them up to the end of the line
+var sbatchValueRe = regexp.MustCompile(`^[A-Za-z0-9._+@%:,=/-]*$`)
+
+// Check checks the values that end up in #SBATCH directives
+func (d JobData) Check() error {
+	for _, v := range []struct{ name, value string }{
+		{"job name", d.JobName},
+		{"partition", d.Partition},
+		{"mem", d.Mem},
+		{"time", d.Time},
+		{"cpus", d.Cpus},
+	} {
+		if !sbatchValueRe.MatchString(v.value) {
+			return fmt.Errorf("invalid slurm %s %q, use letters, digits and ._+@%%:,=/-", v.name, v.value)
+		}
+	}
+	if d.JobName == "" {
+		return fmt.Errorf("empty slurm job name")
+	}
+	return nil
+}
+
+// RenderJob executes the "sbatch" partial with data, see JobData.Check
+func (lib *Library) RenderJob(w io.Writer, data JobData) error {
+	if err := data.Check(); err != nil {
+		return err
+	}
+	return lib.RenderPartial(w, "sbatch", data)
+}
+
+// Missing returns the required options of the recipe that have no value
+func (r *Recipe) Missing(values map[string]string) []string {
+	var result []string
+	for _, o := range r.Required {
+		if strings.TrimSpace(values[o]) == "" {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+// requiredOptions collects the (non optional) option fields referenced by the
+// template name and the partials it includes
+func requiredOptions(t *template.Template, name string) ([]string, []string) {
+	fields := make(map[string]bool)
+	visited := make(map[string]bool)
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			for _, a := range n.Args {
+				walk(a)
+			}
+		case *parse.FieldNode:
+			fields[n.Ident[0]] = true
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+			if visited[n.Name] {
+				return
+			}
+			visited[n.Name] = true
+			if sub := t.Lookup(n.Name); sub != nil && sub.Tree != nil {
+				walk(sub.Tree.Root)
+			}
+		}
+	}
+	walk(t.Lookup(name).Tree.Root)
+
+	options := make(map[string]bool)
+	for f := range fields {
+		if o, ok := optionFields[f]; ok && !optionalOptions[o] {
+			options[o] = true
+		}
+	}
+	return sortedKeys(options), sortedKeys(visited)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,375 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadLibrary(t *testing.T) {
+	dir := t.TempDir()
+	templates := map[string]string{
+		"_greeting.tmpl": `{{ define "greeting" }}echo {{ .Name }}{{ end }}`,
+		"hello.tmpl":     "{{/* Say hello */ -}}\n{{ template \"greeting\" . }} {{ .Easyconfig }}",
+		"fetch.tmpl":     "{{/* Site specific fetch */ -}}\neb --fetch {{ template \"eessi_init\" . }}",
+	}
+	for name, src := range templates {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lib, err := LoadLibrary(&Config{TemplateDir: dir})
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+
+	var requiredTests = []struct {
+		recipe      string
+		description string
+		required    []string
+	}{
+		{"hello", "Say hello", []string{"easyconfig", "name"}},
+		{"fetch", "Site specific fetch", []string{"stackver"}},
+		{DefaultRecipe, "Install the easystack of a toolchain and archive the result with crtar", []string{"ebver", "gitrepo", "name", "stackver", "toolchain"}},
+	}
+	for _, e := range requiredTests {
+		r, err := lib.Recipe(e.recipe)
+		if err != nil {
+			t.Fatalf("Recipe(%s): %s", e.recipe, err)
+		}
+		if r.Description != e.description {
+			t.Errorf("Recipe(%s) got description %q, want %q", e.recipe, r.Description, e.description)
+		}
+		if !reflect.DeepEqual(r.Required, e.required) {
+			t.Errorf("Recipe(%s) got required %v, want %v", e.recipe, r.Required, e.required)
+		}
+	}
+
+	r, _ := lib.Recipe("hello")
+	if missing := r.Missing(map[string]string{"name": "Go"}); !reflect.DeepEqual(missing, []string{"easyconfig"}) {
+		t.Errorf("Missing got %v, want [easyconfig]", missing)
+	}
+
+	var out bytes.Buffer
+	if err := lib.Render(&out, "hello", BuildCmdData{Name: "Go", Easyconfig: "Go-1.25.0.eb"}); err != nil {
+		t.Fatalf("Render: %s", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != "echo Go Go-1.25.0.eb" {
+		t.Errorf("Render got %q", got)
+	}
+
+	if _, err := lib.Recipe("nope"); err == nil {
+		t.Errorf("Recipe(nope) succeeded")
+	}
+}
+
+func TestRenderJob(t *testing.T) {
+	p := writeTestConfig(t, `
+slurm:
+  partition: zen4_0768
+  mem: 64G
+  cpus: 16
+  toolchains:
+    foss-2023b:
+      mem: 128G
+samctr:
+  config: /opt/adm/samctr/config.yaml
+  writeable_repositories: [software.asc.ac.at]
+`)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	want := JobOptions{Partition: "zen4_0768", Mem: "128G", Cpus: "16"}
+	if got := c.JobOptions("foss-2023b"); got != want {
+		t.Errorf("JobOptions(foss-2023b) got %v, want %v", got, want)
+	}
+
+	lib, err := LoadLibrary(c)
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+	var out bytes.Buffer
+	data := JobData{
+		JobOptions:     want,
+		JobName:        "Go-foss-2023b",
+		SamctrConfig:   c.Samctr.Config,
+		WriteableRepos: "software.asc.ac.at",
+		BuildCmd:       "eb -r Go-1.25.0.eb && echo done",
+	}
+	if err := lib.RenderJob(&out, data); err != nil {
+		t.Fatalf("RenderJob: %s", err)
+	}
+	for _, line := range []string{
+		"#SBATCH --job-name=Go-foss-2023b",
+		"#SBATCH --partition=zen4_0768",
+		"#SBATCH --mem=128G",
+		"#SBATCH --cpus-per-task=16",
+		"eb -r Go-1.25.0.eb && echo done",
+		`samctr --config=/opt/adm/samctr/config.yaml --writeable-repositories=software.asc.ac.at exec -- /bin/bash <"${build_cmd}"`,
+	} {
+		if !strings.Contains(out.String(), line+"\n") {
+			t.Errorf("RenderJob output lacks %q:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "--time") {
+		t.Errorf("RenderJob rendered an empty --time directive")
+	}
+
+	for _, name := range []string{"R&D", "Go foss", "Go\nid", ""} {
+		data.JobName = name
+		if err := lib.RenderJob(&out, data); err == nil {
+			t.Errorf("RenderJob accepted the job name %q", name)
+		}
+	}
+	data.JobName = "Go"
+	data.Partition = "zen4\n#SBATCH --uid=0"
+	if err := lib.RenderJob(&out, data); err == nil {
+		t.Errorf("RenderJob accepted the partition %q", data.Partition)
+	}
+}
+
+func TestRenderArch(t *testing.T) {
+	p := writeTestConfig(t, `
+matrix:
+  x86_64/amd/zen4:
+    partition: zen4_0768
+  x86_64/intel/sapphirerapids:
+    partition: spr_0512
+    software_subdir_override: x86_64/intel/icelake
+`)
+	c, err := LoadConfig(p)
+	if err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	var archTests = []struct {
+		arch, partition, override string
+	}{
+		{"x86_64/amd/zen4", "zen4_0768", "x86_64/amd/zen4"},
+		{"x86_64/intel/sapphirerapids", "spr_0512", "x86_64/intel/icelake"},
+	}
+	lib, err := LoadLibrary(c)
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+	for _, tt := range archTests {
+		a, err := c.Arch(tt.arch)
+		if err != nil {
+			t.Fatalf("Arch(%s): %s", tt.arch, err)
+		}
+		if a.Partition != tt.partition || a.SoftwareSubdirOverride != tt.override {
+			t.Errorf("Arch(%s) got %+v", tt.arch, a)
+		}
+		var out bytes.Buffer
+		data := BuildCmdData{StackVer: "2025.06", Name: "foss", Toolchain: "foss-2025a", CpuArchSubdir: tt.arch, SoftwareSubdirOverride: a.SoftwareSubdirOverride}
+		if err := lib.Render(&out, DefaultRecipe, data); err != nil {
+			t.Fatalf("Render: %s", err)
+		}
+		for _, s := range []string{
+			"export EESSI_SOFTWARE_SUBDIR_OVERRIDE=" + tt.override + "\n",
+			"-cpuArchSubdir " + tt.arch + "\n",
+		} {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("Render for %s lacks %q:\n%s", tt.arch, s, out.String())
+			}
+		}
+	}
+	if _, err := c.Arch("aarch64/neoverse_v1"); err == nil {
+		t.Errorf("Arch of an arch not in the matrix succeeded")
+	}
+}
+
+func TestRenderEasyBuild(t *testing.T) {
+	lib, err := LoadLibrary(&Config{})
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+	opts := EasyBuildOptions{
+		{Section: "config", Key: "buildpath", Value: "/local/${USER}/$(id)"},
+		{Section: "override", Key: "accept-eula-for", Value: "CUDA"},
+	}
+	var formatTests = []struct {
+		format string
+		want   []string
+	}{
+		{"env", []string{
+			`export EASYBUILD_BUILDPATH="/local/${USER}/\$(id)"` + "\n",
+			`export EASYBUILD_ACCEPT_EULA_FOR="CUDA"` + "\n",
+		}},
+		{"cfg", []string{
+			"cat >\"${eb_cfg}\" <<EOEB\n[config]\nbuildpath = /local/${USER}/\\$(id)\n\n[override]\naccept-eula-for = CUDA\nEOEB\n",
+			"unset EASYBUILD_BUILDPATH EASYBUILD_ACCEPT_EULA_FOR\n",
+		}},
+	}
+	for _, tt := range formatTests {
+		var out bytes.Buffer
+		if err := lib.RenderPartial(&out, "easybuild", BuildCmdData{EasyBuild: opts, EasyBuildFormat: tt.format}); err != nil {
+			t.Fatalf("RenderPartial: %s", err)
+		}
+		for _, s := range tt.want {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("easybuild partial with format %s lacks %q:\n%s", tt.format, s, out.String())
+			}
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	var splitTests = []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"--from-pr 123 --include-easyblocks-from-pr 45", []string{"--from-pr", "123", "--include-easyblocks-from-pr", "45"}},
+		{`--robot-paths='/a b:/c'  -x`, []string{"--robot-paths=/a b:/c", "-x"}},
+		{`--filter-deps="Java,\"x\"" a\ b`, []string{`--filter-deps=Java,"x"`, "a b"}},
+	}
+	for _, tt := range splitTests {
+		got, err := SplitWords(tt.in)
+		if err != nil {
+			t.Errorf("SplitWords(%q): %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitWords(%q) got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	for _, s := range []string{`--from-pr 'x`, `"abc`} {
+		if _, err := SplitWords(s); err == nil {
+			t.Errorf("SplitWords(%q) succeeded", s)
+		}
+	}
+
+	var quoteTests = []struct {
+		in, want string
+	}{
+		{"foss-2023b", "foss-2023b"},
+		{"", "''"},
+		{"a&b<c", "'a&b<c'"},
+		{"it's $HOME", `'it'\''s $HOME'`},
+	}
+	for _, tt := range quoteTests {
+		if got := Quote(tt.in); got != tt.want {
+			t.Errorf("Quote(%q) got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	var expandTests = []struct {
+		in, dquote, heredoc string
+	}{
+		{"/local/${USER}/eb", `"/local/${USER}/eb"`, "/local/${USER}/eb"},
+		{"$(touch /tmp/x)", `"\$(touch /tmp/x)"`, `\$(touch /tmp/x)`},
+		{"`id` $HOME ${X:-$(id)}", "\"\\`id\\` \\$HOME \\${X:-\\$(id)}\"", "\\`id\\` \\$HOME \\${X:-\\$(id)}"},
+		{`a"b\c`, `"a\"b\\c"`, `a"b\\c`},
+	}
+	for _, tt := range expandTests {
+		if got := DoubleQuote(tt.in); got != tt.dquote {
+			t.Errorf("DoubleQuote(%q) got %s, want %s", tt.in, got, tt.dquote)
+		}
+		if got := Heredoc(tt.in); got != tt.heredoc {
+			t.Errorf("Heredoc(%q) got %s, want %s", tt.in, got, tt.heredoc)
+		}
+	}
+
+	lib, err := LoadLibrary(&Config{})
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+	var out bytes.Buffer
+	data := BuildCmdData{
+		StackVer:    "2025.06",
+		Name:        "R&D",
+		ArchiveName: "R&D",
+		Easyconfig:  "Go-1.25.0.eb",
+		EbOpts:      []string{"--from-pr", "123", "--robot-paths=/a b"},
+	}
+	if err := lib.Render(&out, "easyconfig", data); err != nil {
+		t.Fatalf("Render: %s", err)
+	}
+	for _, s := range []string{
+		"eb -r Go-1.25.0.eb --from-pr 123 '--robot-paths=/a b' \\\n",
+		`-name 'R&D'-"${TS}"`,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Render lacks %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	lib, err := LoadLibrary(&Config{})
+	if err != nil {
+		t.Fatalf("LoadLibrary: %s", err)
+	}
+	r, _ := lib.Recipe(DefaultRecipe)
+	data := BuildCmdData{StackVer: "2025.06", Name: "foss", Toolchain: "foss-2025a", ArchiveName: "foss-foss-2025a", CpuArchSubdir: "x86_64/amd/zen4"}
+	es := &Easystack{Path: "asc_eb_5.2.0-foss-2025a.yaml", Easyconfigs: []EasystackEntry{
+		{Easyconfig: "Go-1.25.0.eb"},
+		{Easyconfig: "zlib-1.3.1-GCCcore-14.2.0.eb", Options: map[string]any{"from-pr": 22000}},
+	}}
+	resolved := []ResolvedEasyconfig{
+		{EasystackEntry: es.Easyconfigs[0], Source: SourceGitRepo, Path: "easyconfigs/Go-1.25.0.eb"},
+		{EasystackEntry: es.Easyconfigs[1], Source: SourcePR, Path: "22000"},
+	}
+	plan, err := NewPlan(lib, r, map[string]string{"name": "foss"}, data, es, resolved)
+	if err != nil {
+		t.Fatalf("NewPlan: %s", err)
+	}
+	wantCrtar := []string{"crtar", "-EESSI-version", "2025.06", "-name", "foss-foss-2025a-${TS}", "-cpuArchSubdir", "x86_64/amd/zen4"}
+	if !reflect.DeepEqual(plan.Crtar, wantCrtar) {
+		t.Errorf("NewPlan got crtar %q, want %q", plan.Crtar, wantCrtar)
+	}
+	if want := "foss-foss-2025a-${TS}-x86_64-amd-zen4-<timestamp>.tar.gz"; plan.Tarball != want {
+		t.Errorf("NewPlan got tarball %s, want %s", plan.Tarball, want)
+	}
+
+	p := filepath.Join(t.TempDir(), "plan.json")
+	var out bytes.Buffer
+	if err := plan.Write(&out); err != nil {
+		t.Fatalf("Write: %s", err)
+	}
+	if err := os.WriteFile(p, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPlan(p)
+	if err != nil {
+		t.Fatalf("ReadPlan: %s", err)
+	}
+	a, _ := es.Marshal()
+	b, _ := read.EasystackOf(es.Path).Marshal()
+	if !bytes.Equal(a, b) {
+		t.Errorf("easystack of the plan read back got\n%s\nwant\n%s", b, a)
+	}
+	if err := read.CheckDerived(plan); err != nil {
+		t.Errorf("CheckDerived of the plan read back: %s", err)
+	}
+	for name, edit := range map[string]func(p *Plan){
+		"easystack": func(p *Plan) { p.Easystack = "other.yaml" },
+		"crtar":     func(p *Plan) { p.Crtar = append(p.Crtar, "-force") },
+		"tarball":   func(p *Plan) { p.Tarball = "foss.tar.gz" },
+	} {
+		edited, _ := ReadPlan(p)
+		edit(edited)
+		if err := edited.CheckDerived(plan); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("CheckDerived of a plan with an edited %s got %v", name, err)
+		}
+	}
+	read.Crtar, read.Tarball, read.Easystack = nil, "", ""
+	if err := read.CheckDerived(plan); err != nil {
+		t.Errorf("CheckDerived of a plan without derived fields: %s", err)
+	}
+
+	if err := os.WriteFile(p, []byte(`{"params": {}, "crtar_args": []}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPlan(p); err == nil {
+		t.Errorf("ReadPlan with an unknown field succeeded")
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A StackEasystack is one asc_eb_<ebver>-<toolchain>.yaml file found below
+// <gitrepo>/easystacks/<stackver>/
+type StackEasystack struct {
+	StackVer, EbVer, Toolchain, Path string
+}
+
+// easybuild versions do not contain "-", toolchains may
+var easystackNameRe = regexp.MustCompile(`^asc_eb_([^-]+)-(.+)\.yaml$`)
+
+// DiscoverStacks scans the easystacks dir of the git repo, the result is
+// sorted by stack version, easybuild version and toolchain
+func DiscoverStacks(gitRepo string) ([]StackEasystack, error) {
+	if gitRepo == "" {
+		return nil, fmt.Errorf("no git repo given")
+	}
+	matches, err := filepath.Glob(filepath.Join(gitRepo, "easystacks", "*", "asc_eb_*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("glob error for %q: %w", gitRepo, err)
+	}
+	if len(matches) == 0 {
+		if _, err := os.Stat(filepath.Join(gitRepo, "easystacks")); err != nil {
+			return nil, fmt.Errorf("no easystacks in %s: %w", gitRepo, err)
+		}
+	}
+	var result []StackEasystack
+	for _, m := range matches {
+		sub := easystackNameRe.FindStringSubmatch(filepath.Base(m))
+		if sub == nil {
+			continue
+		}
+		result = append(result, StackEasystack{
+			StackVer:  filepath.Base(filepath.Dir(m)),
+			EbVer:     sub[1],
+			Toolchain: sub[2],
+			Path:      m,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.StackVer != b.StackVer {
+			return CompareVersions(a.StackVer, b.StackVer) < 0
+		}
+		if a.EbVer != b.EbVer {
+			return CompareVersions(a.EbVer, b.EbVer) < 0
+		}
+		return a.Toolchain < b.Toolchain
+	})
+	return result, nil
+}
+
+// DefaultEbVer returns the (newest) easybuild version the git repo uses for
+// stackver, restricted to toolchain if it is not empty
+func DefaultEbVer(stacks []StackEasystack, stackVer, toolchain string) string {
+	result := ""
+	for _, s := range stacks {
+		if s.StackVer != stackVer || (toolchain != "" && s.Toolchain != toolchain) {
+			continue
+		}
+		if result == "" || CompareVersions(s.EbVer, result) > 0 {
+			result = s.EbVer
+		}
+	}
+	return result
+}
+
+// CompareVersions compares dotted versions like 5.2.0 or 2023.06 numerically
+// component by component, non numeric components are compared as strings
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		ai, aerr := strconv.Atoi(as[i])
+		bi, berr := strconv.Atoi(bs[i])
+		if aerr == nil && berr == nil {
+			if ai != bi {
+				return ai - bi
+			}
+			continue
+		}
+		if c := strings.Compare(as[i], bs[i]); c != 0 {
+			return c
+		}
+	}
+	return len(as) - len(bs)
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/asc-ac-at/sam/internal/util"
+)
+
+// CheckStack checks that the git repo has an easystack for the stack version,
+// toolchain and easybuild version. The error names the closest known value.
+// Empty values are not checked.
+func CheckStack(stacks []StackEasystack, stackVer, ebVer, toolchain string) error {
+	var stackVers, toolchains, ebVers []string
+	for _, s := range stacks {
+		stackVers = appendNew(stackVers, s.StackVer)
+		if s.StackVer != stackVer {
+			continue
+		}
+		toolchains = appendNew(toolchains, s.Toolchain)
+		if s.Toolchain == toolchain {
+			ebVers = appendNew(ebVers, s.EbVer)
+		}
+	}
+	switch {
+	case stackVer == "":
+		return nil
+	case !slices.Contains(stackVers, stackVer):
+		return fmt.Errorf("no easystacks for stack version %q%s", stackVer, suggest(stackVer, stackVers))
+	case toolchain == "":
+		return nil
+	case !slices.Contains(toolchains, toolchain):
+		return fmt.Errorf("unknown toolchain %q for stack %s%s", toolchain, stackVer, suggest(toolchain, toolchains))
+	case ebVer != "" && !slices.Contains(ebVers, ebVer):
+		return fmt.Errorf("no easystack for toolchain %s of stack %s with ebver %q%s", toolchain, stackVer, ebVer, suggest(ebVer, ebVers))
+	}
+	return nil
+}
+
+// CheckToolchainName checks that the name part of toolchain (foss of
+// foss-2023b) is one of the toolchains known to EasyBuild
+func CheckToolchainName(toolchain string, ebToolchains []string) error {
+	name, _, _ := strings.Cut(toolchain, "-")
+	if slices.Contains(ebToolchains, name) {
+		return nil
+	}
+	return fmt.Errorf("%q is not an EasyBuild toolchain%s", name, suggest(name, ebToolchains))
+}
+
+// "\tfoss: BLACS, FFTW, GCC, ..." lines of eb --list-toolchains
+var ebToolchainRe = regexp.MustCompile(`^\s+(\S+):`)
+
+// EasyBuildToolchains returns the toolchains known to the EasyBuild run as eb
+// (e.g. ["eb"]), from eb --list-toolchains
+func EasyBuildToolchains(eb []string) ([]string, error) {
+	if len(eb) == 0 {
+		return nil, fmt.Errorf("no eb command configured")
+	}
+	out, err := exec.Command(eb[0], append(eb[1:], "--list-toolchains")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --list-toolchains failed: %w", eb[0], err)
+	}
+	var result []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if m := ebToolchainRe.FindStringSubmatch(line); m != nil {
+			result = append(result, m[1])
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s --list-toolchains listed no toolchains", eb[0])
+	}
+	return result, nil
+}
+
+// "robot-paths (D) = /a, /b" line of eb --show-config
+var ebRobotPathsRe = regexp.MustCompile(`^robot-paths\s+\(\w\)\s*=\s*(.*)$`)
+
+// EasyBuildRobotPaths returns the robot paths of the EasyBuild run as eb,
+// as printed by eb --show-config
+func EasyBuildRobotPaths(eb []string) ([]string, error) {
+	if len(eb) == 0 {
+		return nil, fmt.Errorf("no eb command configured")
+	}
+	out, err := exec.Command(eb[0], append(eb[1:], "--show-config")...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s --show-config failed: %w", eb[0], err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		m := ebRobotPathsRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		var result []string
+		for _, p := range strings.Split(m[1], ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				result = append(result, p)
+			}
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("%s --show-config lists no robot-paths", eb[0])
+}
+
+// suggest returns ", did you mean "<closest>"? (known: ...)" for an unknown
+// value s, the suggestion is left out if no candidate is close enough
+func suggest(s string, candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	result := ""
+	if c := util.ClosestMatch(s, candidates); c != "" {
+		result = fmt.Sprintf(", did you mean %q?", c)
+	}
+	return result + " (known: " + strings.Join(candidates, ", ") + ")"
+}
+
+func appendNew(list []string, s string) []string {
+	if slices.Contains(list, s) {
+		return list
+	}
+	return append(list, s)
+}
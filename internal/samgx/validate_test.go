@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samgx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckStack(t *testing.T) {
+	stacks := []StackEasystack{
+		{"2023.06", "4.9.4", "foss-2023b", ""},
+		{"2025.06", "5.2.0", "foss-2024a", ""},
+		{"2025.06", "5.2.0", "foss-2025a", ""},
+		{"2025.06", "5.2.0", "foss-2024a-CUDA-12.6.0", ""},
+	}
+	var tests = []struct {
+		stackver, ebver, toolchain string
+		// substring of the error, empty if valid
+		want string
+	}{
+		{"2025.06", "5.2.0", "foss-2024a", ""},
+		{"2025.6", "5.2.0", "foss-2024a", `no easystacks for stack version "2025.6", did you mean "2025.06"?`},
+		{"2025.06", "5.2.0", "fos-2024a", `unknown toolchain "fos-2024a" for stack 2025.06, did you mean "foss-2024a"?`},
+		{"2025.06", "5.2.0", "foss-2023b", `did you mean "foss-2024a"?`},
+		{"2025.06", "5.2.0", "gompi", "(known: foss-2024a, foss-2025a, foss-2024a-CUDA-12.6.0)"},
+		{"2025.06", "5.2", "foss-2025a", `with ebver "5.2", did you mean "5.2.0"?`},
+	}
+	for _, tt := range tests {
+		err := CheckStack(stacks, tt.stackver, tt.ebver, tt.toolchain)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("CheckStack(%s, %s, %s): %s", tt.stackver, tt.ebver, tt.toolchain, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("CheckStack(%s, %s, %s) got %v, want %q", tt.stackver, tt.ebver, tt.toolchain, err, tt.want)
+		}
+	}
+	if err := CheckStack(stacks, "2025.06", "5.2.0", "gompi"); strings.Contains(err.Error(), "did you mean") {
+		t.Errorf("CheckStack suggested a toolchain far from gompi: %s", err)
+	}
+}
+
+func TestEasyBuildToolchains(t *testing.T) {
+	eb := fakeCmd(t, t.TempDir(), "eb", `cat <<'EOT'
+List of known toolchains (toolchain name: module[, module, ...]):
+	GCC: GCC
+	foss: BLACS, FFTW, GCC, OpenBLAS, OpenMPI, ScaLAPACK
+	gompi: GCC, OpenMPI
+EOT
+`)
+	toolchains, err := EasyBuildToolchains([]string{eb})
+	if err != nil {
+		t.Fatalf("EasyBuildToolchains: %s", err)
+	}
+	if want := []string{"GCC", "foss", "gompi"}; !reflect.DeepEqual(toolchains, want) {
+		t.Errorf("EasyBuildToolchains got %v, want %v", toolchains, want)
+	}
+	if err := CheckToolchainName("foss-2024a-CUDA-12.6.0", toolchains); err != nil {
+		t.Errorf("CheckToolchainName: %s", err)
+	}
+	err = CheckToolchainName("fosss-2024a", toolchains)
+	if err == nil || !strings.Contains(err.Error(), `did you mean "foss"?`) {
+		t.Errorf("CheckToolchainName(fosss-2024a) got %v", err)
+	}
+}
+
+func TestEasyBuildRobotPaths(t *testing.T) {
+	eb := fakeCmd(t, t.TempDir(), "eb", `cat <<'EOT'
+#
+# Current EasyBuild configuration
+# (C: command line argument, D: default value, E: environment variable, F: configuration file)
+#
+buildpath      (E) = /tmp/build
+robot-paths    (E) = /cvmfs/software.eessi.io/easyconfigs, /home/user/easyconfigs
+EOT
+`)
+	paths, err := EasyBuildRobotPaths([]string{eb})
+	if err != nil {
+		t.Fatalf("EasyBuildRobotPaths: %s", err)
+	}
+	if want := []string{"/cvmfs/software.eessi.io/easyconfigs", "/home/user/easyconfigs"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("EasyBuildRobotPaths got %v, want %v", paths, want)
+	}
+	eb = fakeCmd(t, t.TempDir(), "eb", "echo 'buildpath (D) = /tmp'\n")
+	if _, err := EasyBuildRobotPaths([]string{eb}); err == nil {
+		t.Errorf("EasyBuildRobotPaths without robot-paths succeeded")
+	}
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+
+// Package util holds helpers shared by samgx, samctr and crtar
+package util
+
+import "strings"
+
+// ClosestMatch returns the candidate with the smallest edit distance to s,
+// ignoring case, empty if even that differs in more than a third of its
+// characters
+func ClosestMatch(s string, candidates []string) string {
+	best, bestDist := "", -1
+	for _, c := range candidates {
+		if d := EditDistance(strings.ToLower(s), strings.ToLower(c)); bestDist < 0 || d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	if bestDist < 0 || bestDist > max(len(s), len(best))/3+1 {
+		return ""
+	}
+	return best
+}
+
+// EditDistance returns the Levenshtein distance of a and b
+func EditDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
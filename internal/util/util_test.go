@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+   (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClosestMatch(t *testing.T) {
+	candidates := []string{"foss", "gompi", "writeable_repos", "bind_paths"}
+	var tests = []struct {
+		s, want string
+	}{
+		{"fosss", "foss"},
+		{"FOSS", "foss"},
+		{"writable_repos", "writeable_repos"},
+		{"bindpaths", "bind_paths"},
+		{"intel", ""},
+	}
+	for _, tt := range tests {
+		if got := ClosestMatch(tt.s, candidates); got != tt.want {
+			t.Errorf("ClosestMatch(%s) got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+	if got := ClosestMatch("foss", nil); got != "" {
+		t.Errorf("ClosestMatch without candidates got %q", got)
+	}
+	if d := EditDistance("kitten", "sitting"); d != 3 {
+		t.Errorf("EditDistance(kitten, sitting) got %d, want 3", d)
+	}
+}
+
+func TestFileSHA256(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(p, []byte("abc"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum, err := FileSHA256(p)
+	if err != nil {
+		t.Fatalf("FileSHA256: %s", err)
+	}
+	if want := "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; sum != want {
+		t.Errorf("FileSHA256 got %s, want %s", sum, want)
+	}
+	if _, err := FileSHA256(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("FileSHA256 of a missing file succeeded")
+	}
+}
@@ -10,11 +10,16 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
 
 	isamctr "github.com/asc-ac-at/sam/internal/samctr"
 )
@@ -34,73 +39,228 @@ type Config struct {
 	FuseMounts     []isamctr.FuseMount `mapstructure:"fusemounts"`
 	FuseCmdRW      string              `mapstructure:"fuse_cmd_rw"`
 	WriteableRepos []string            `mapstructure:"writeable_repos"`
+
+	// profile of the profiles section merged into the config
+	Profile string `mapstructure:"profile"`
 }
 
 var AppConfig = &Config{}
 
+// error of loading the config, returned by the commands that need it
+var configErr error
+
 // initConfig should be registered with cobra.OnInitialize(initConfig)
 func initConfig() {
 	if err := LoadConfig(cfgFile, RootCmd); err != nil {
 		log.Printf("warning: failed to load config: %v", err)
+		configErr = err
 	}
 }
 
-func LoadConfig(confPath string, root *cobra.Command) error {
-	// defaults
-	viper.SetDefault("image", Image)
+// EnvPrefix is prepended to the upper cased config key to get the name of the
+// environment variable setting it, e.g. SAMCTR_HOST_INJECTIONS
+const EnvPrefix = "SAMCTR"
 
-	// -- config file --
-	if confPath != "" {
-		viper.SetConfigFile(confPath)
-	} else {
-		// search for it
-		log.Printf("LoadConfig -> searching for config")
-		xdg := ""
-		xdg = os.Getenv("XDG_CONFIG_HOME")
-		if xdg == "" { // fall back to "$HOME/.config"
-			// TODO: replace this with an AppName const
-			home := os.Getenv("HOME")
-			xdg = filepath.Join(home, ".config")
+// config keys of the persistent flags named differently in the config file,
+// the other flags use their name with "-" replaced by "_"
+var flagKeys = map[string]string{
+	"writeable-repositories": "writeable_repos",
+	"fuse":                   "fuse_cmd_rw",
+}
+
+// FlagKey returns the config key a flag sets
+func FlagKey(name string) string {
+	if k, ok := flagKeys[name]; ok {
+		return k
+	}
+	return strings.ReplaceAll(name, "-", "_")
+}
+
+// EnvName returns the name of the environment variable setting key
+func EnvName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(key)
+}
+
+// ConfigKeys returns the keys of the config file, in the order of the fields
+// of Config
+func ConfigKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if k := t.Field(i).Tag.Get("mapstructure"); k != "" && k != "-" {
+			keys = append(keys, k)
 		}
-		viper.AddConfigPath(filepath.Join(xdg, "samctr"))
-		viper.SetConfigName("config")
-		viper.SetConfigType("yaml")
 	}
+	return keys
+}
+
+// ConfigSettings holds the merged settings of the config files, including
+// the profiles section
+var ConfigSettings = isamctr.Settings{}
+
+// ConfigLayers are the config files read and the selected profile, in the
+// order they were merged
+var ConfigLayers []isamctr.Layer
 
-	// env var processing
-	// TODO: apptainer vars
+// SystemConfigDir holds the system config.yaml and the conf.d dir of site
+// config files, it can be changed with SAMCTR_SYSTEM_CONFIG_DIR
+var SystemConfigDir = "/etc/samctr"
 
-	// read file if one was found
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			return fmt.Errorf("error reading config: %w", err)
+// ConfigFiles returns the existing config files in the order they are merged:
+// the system config.yaml, the *.yaml files of conf.d sorted by name and the
+// user config. userPath replaces the default user config path if it is not
+// empty, it has to exist.
+func ConfigFiles(userPath string) ([]string, error) {
+	dir := SystemConfigDir
+	if d := os.Getenv(EnvName("system_config_dir")); d != "" {
+		dir = d
+	}
+	var files []string
+	if p := filepath.Join(dir, "config.yaml"); fileExists(p) {
+		files = append(files, p)
+	}
+	site, err := filepath.Glob(filepath.Join(dir, "conf.d", "*.yaml"))
+	if err != nil {
+		return nil, fmt.Errorf("error searching site configs: %w", err)
+	}
+	sort.Strings(site)
+	files = append(files, site...)
+
+	if userPath != "" {
+		if !fileExists(userPath) {
+			return nil, fmt.Errorf("error reading config: %s not found", userPath)
 		}
-	} else {
-		log.Printf("Using config file: %s", viper.ConfigFileUsed())
+		return append(files, userPath), nil
+	}
+	// search for it
+	if p := DefaultConfigPath(); fileExists(p) {
+		files = append(files, p)
+	}
+	return files, nil
+}
+
+func fileExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && !fi.IsDir()
+}
+
+// DefaultConfigPath returns $XDG_CONFIG_HOME/samctr/config.yaml, falling back
+// to $HOME/.config/samctr/config.yaml
+func DefaultConfigPath() string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" { // fall back to "$HOME/.config"
+		// TODO: replace this with an AppName const
+		home := os.Getenv("HOME")
+		xdg = filepath.Join(home, ".config")
+	}
+	return filepath.Join(xdg, "samctr", "config.yaml")
+}
+
+// readSettings reads the config file at p
+func readSettings(p string) (isamctr.Settings, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	// nested maps are decoded as map[string]any, not as Settings
+	var settings map[string]any
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("error reading config %s: %w", p, err)
+	}
+	if settings == nil { // empty file
+		settings = map[string]any{}
+	}
+	return settings, nil
+}
+
+func LoadConfig(confPath string, root *cobra.Command) error {
+	if confPath == "" {
+		confPath = os.Getenv(EnvName("config"))
+	}
+
+	// env var processing, every config key can be set with SAMCTR_<KEY>
+	viper.SetEnvPrefix(EnvPrefix)
+	for _, key := range ConfigKeys() {
+		_ = viper.BindEnv(key)
 	}
 
 	// bind flags to viper
 	// Precedence (highest first) is: flag, env var, config file, default.
+	// The default of a key set by a flag is the default of the flag.
 
 	if root != nil {
-		_ = viper.BindPFlags(root.PersistentFlags())
-		_ = viper.BindPFlags(root.Flags())
-
-		// Propagate values into flag.Value
-
-		propagate := func(fs *pflag.FlagSet) {
+		keys := ConfigKeys()
+		bind := func(fs *pflag.FlagSet) {
 			fs.VisitAll(func(f *pflag.Flag) {
-				if viper.IsSet(f.Name) {
-					_ = f.Value.Set(viper.GetString(f.Name))
+				key := FlagKey(f.Name)
+				_ = viper.BindPFlag(key, f)
+				_ = viper.BindEnv(key)
+				if slices.Contains(keys, key) || f.Changed {
+					return
+				}
+				// flags without a config key (--resume, --to-stdout, ...)
+				// are read from their variable, set it from the env
+				if v := os.Getenv(EnvName(key)); v != "" {
+					if err := f.Value.Set(v); err != nil {
+						log.Printf("warning: invalid %s: %v", EnvName(key), err)
+					}
 				}
 			})
 		}
-		propagate(root.PersistentFlags())
-		propagate(root.Flags())
+		bind(root.PersistentFlags())
+		bind(root.Flags())
+		checkEnv(root)
+	}
+
+	// -- config files --
+	files, err := ConfigFiles(confPath)
+	if err != nil {
+		return err
+	}
+	ConfigSettings = isamctr.Settings{}
+	ConfigLayers = nil
+	for _, p := range files {
+		settings, err := readSettings(p)
+		if err != nil {
+			return err
+		}
+		if errs := checkKeys(settings); len(errs) > 0 {
+			for i := range errs {
+				errs[i] = fmt.Errorf("%s: %w", p, errs[i])
+			}
+			return errors.Join(errs...)
+		}
+		ConfigSettings = isamctr.MergeSettings(ConfigSettings, settings)
+		ConfigLayers = append(ConfigLayers, isamctr.Layer{Name: p, Settings: settings})
+		log.Printf("Using config file: %s", p)
+	}
+
+	// the profile selected with --profile or SAMCTR_PROFILE, falling back on
+	// the profile key of the file
+	profile := viper.GetString("profile")
+	if profile == "" {
+		profile, _ = ConfigSettings["profile"].(string)
+	}
+	settings, err := ConfigSettings.ApplyProfile(profile)
+	if err != nil {
+		return err
+	}
+	if profile != "" {
+		profiles, _ := ConfigSettings.Profiles()
+		ConfigLayers = append(ConfigLayers, isamctr.Layer{Name: "profile " + profile, Settings: profiles[profile]})
+		log.Printf("Using profile: %s", profile)
+	}
+	if err := viper.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("error reading config: %w", err)
 	}
 
 	// unmarshall into AppConfig struct
-	if err := viper.Unmarshal(AppConfig); err != nil {
+	hook := mapstructure.ComposeDecodeHookFunc(
+		yamlStringHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)
+	if err := viper.Unmarshal(AppConfig, viper.DecodeHook(hook)); err != nil {
 		return fmt.Errorf("unable to decode config into struct: %w", err)
 	}
 
@@ -112,6 +272,102 @@ func LoadConfig(confPath string, root *cobra.Command) error {
 	return nil
 }
 
+// checkKeys reports the keys of settings read from a config file that are
+// not config keys, together with the closest config key. viper.Unmarshal
+// would silently ignore them.
+func checkKeys(settings isamctr.Settings) []error {
+	return unknownKeys("", settings, reflect.TypeOf(Config{}), true)
+}
+
+// unknownKeys checks the keys of m against the mapstructure tags of t, the
+// entries of lists of structs (fusemounts) and the profiles are checked too
+func unknownKeys(prefix string, m map[string]any, t reflect.Type, profiles bool) []error {
+	fields := make(map[string]reflect.Type)
+	var known []string
+	for i := 0; i < t.NumField(); i++ {
+		if k := t.Field(i).Tag.Get("mapstructure"); k != "" && k != "-" {
+			fields[k] = t.Field(i).Type
+			known = append(known, k)
+		}
+	}
+	if profiles {
+		known = append(known, "profiles")
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, k := range keys {
+		ft, ok := fields[k]
+		switch {
+		case k == "profiles" && profiles:
+			ps, err := isamctr.Settings{"profiles": m[k]}.Profiles()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, name := range isamctr.Settings(m).ProfileNames() {
+				if _, ok := ps[name]["profile"]; ok {
+					errs = append(errs, fmt.Errorf("configuration error: %sprofiles.%s.profile: a profile cannot select another profile", prefix, name))
+				}
+				errs = append(errs, unknownKeys(prefix+"profiles."+name+".", ps[name], t, false)...)
+			}
+		case !ok:
+			errs = append(errs, fmt.Errorf("configuration error: unknown key %s%s%s", prefix, k, isamctr.Suggest(k, known)))
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Struct:
+			list, _ := m[k].([]any)
+			for i, e := range list {
+				if em, ok := e.(map[string]any); ok {
+					errs = append(errs, unknownKeys(fmt.Sprintf("%s%s[%d].", prefix, k, i), em, ft.Elem(), false)...)
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// checkEnv warns about SAMCTR_* environment variables that set nothing
+func checkEnv(root *cobra.Command) {
+	known := []string{EnvName("system_config_dir")}
+	for _, k := range ConfigKeys() {
+		known = append(known, EnvName(k))
+	}
+	root.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		known = append(known, EnvName(FlagKey(f.Name)))
+	})
+	for _, e := range os.Environ() {
+		name, _, _ := strings.Cut(e, "=")
+		if strings.HasPrefix(name, EnvPrefix+"_") && !slices.Contains(known, name) {
+			log.Printf("warning: unknown environment variable %s%s", name, isamctr.Suggest(name, known))
+		}
+	}
+}
+
+// yamlStringHook decodes a string set for a list of structs, like
+// SAMCTR_FUSEMOUNTS, as YAML (e.g. a flow sequence "[{type: container, ...}]")
+func yamlStringHook(from, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Slice || to.Elem().Kind() != reflect.Struct {
+		return data, nil
+	}
+	var result []any
+	if err := yaml.Unmarshal([]byte(data.(string)), &result); err != nil {
+		return nil, fmt.Errorf("decoding %q: %w", data, err)
+	}
+	var errs []error
+	for i, e := range result {
+		if em, ok := e.(map[string]any); ok {
+			errs = append(errs, unknownKeys(fmt.Sprintf("[%d].", i), em, to.Elem(), false)...)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // validateRequiredConfig verifies that required config values are present.
 // Add or remove required checks here.
 func validateRequiredConfig(c *Config) error {
@@ -140,16 +396,82 @@ func validateRequiredConfig(c *Config) error {
 	nvidia_mode := strings.TrimSpace(c.Nvidia)
 	if nvidia_mode != "all" {
 		// in the future we may use "install,run"
-		return fmt.Errorf("configuration error: nvidia mode %s not supported")
+		return fmt.Errorf("configuration error: nvidia mode %s not supported", nvidia_mode)
 	}
 
 	if len(c.WriteableRepos) > 0 {
 		// there needs to be a fuse type set, if there is none, use the default
 		// (or later fall back on cli flag)
 		if strings.TrimSpace(c.FuseCmdRW) == "" {
-			FuseCmdRW = "fuse-overlayfs"
+			c.FuseCmdRW = "fuse-overlayfs"
 		}
 
 	}
 	return nil
 }
+
+// fusemount types known to apptainer
+var fuseMountTypes = []string{"container", "host", "container-daemon", "host-daemon"}
+
+// fuse commands FuseMount.FuseArgFmt knows the arguments of
+var fuseCmds = []string{"cvmfs2", "fuse-overlayfs", "unionfs"}
+
+// checkConfig does the checks of samctr config validate that go beyond
+// validateRequiredConfig, it returns all problems found
+func checkConfig(c *Config) []error {
+	var problems []error
+	for i, fm := range c.FuseMounts {
+		if !slices.Contains(fuseMountTypes, fm.Type) {
+			problems = append(problems, fmt.Errorf("configuration error: fusemounts[%d]: unknown type %q (known: %s)", i, fm.Type, strings.Join(fuseMountTypes, ", ")))
+		}
+		if !slices.Contains(fuseCmds, fm.FuseCmd) {
+			problems = append(problems, fmt.Errorf("configuration error: fusemounts[%d]: unknown fuse_cmd %q (known: %s)", i, fm.FuseCmd, strings.Join(fuseCmds, ", ")))
+		}
+	}
+	if len(c.WriteableRepos) > 0 && !slices.Contains(fuseCmds[1:], c.FuseCmdRW) {
+		problems = append(problems, fmt.Errorf("configuration error: unknown fuse_cmd_rw %q (known: %s)", c.FuseCmdRW, strings.Join(fuseCmds[1:], ", ")))
+	}
+	for _, r := range c.WriteableRepos {
+		found := false
+		for _, fm := range c.FuseMounts {
+			found = found || fm.FuseArg == r
+		}
+		if !found {
+			problems = append(problems, fmt.Errorf("configuration error: writeable repository %s has no fusemount with fuse_arg %s", r, r))
+		}
+	}
+
+	// paths on the host
+	if c.HostInjections != "" && !dirExists(c.HostInjections) {
+		problems = append(problems, fmt.Errorf("configuration error: host_injections %s is not a directory", c.HostInjections))
+	}
+	if c.ApptainerVarHome != "" && !dirExists(c.ApptainerVarHome) {
+		problems = append(problems, fmt.Errorf("configuration error: apptainer_var_home %s is not a directory", c.ApptainerVarHome))
+	}
+	if c.ApptainerVarCachedir != "" && !dirExists(c.ApptainerVarCachedir) {
+		problems = append(problems, fmt.Errorf("configuration error: apptainer_var_cachedir %s is not a directory", c.ApptainerVarCachedir))
+	}
+	for _, spec := range c.BindPaths {
+		b, err := isamctr.ParseBindSpec(spec)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("configuration error: invalid bind path %q: %w", spec, err))
+			continue
+		}
+		if _, err := os.Stat(b.Host); err != nil {
+			problems = append(problems, fmt.Errorf("configuration error: bind path %q: %w", spec, err))
+		}
+	}
+
+	// local images have to exist, remote ones are only checked when pulled
+	if c.Image != "" && !strings.Contains(c.Image, "://") {
+		if _, err := os.Stat(c.Image); err != nil {
+			problems = append(problems, fmt.Errorf("configuration error: image: %w", err))
+		}
+	}
+	return problems
+}
+
+func dirExists(p string) bool {
+	fi, err := os.Stat(p)
+	return err == nil && fi.IsDir()
+}
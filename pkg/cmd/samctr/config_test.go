@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.yaml.in/yaml/v3"
+
+	isamctr "github.com/asc-ac-at/sam/internal/samctr"
+)
+
+const testFuseMount = `{type: container, fuse_cmd: cvmfs2, fuse_arg: software.eessi.io, ctr_mountpoint: /cvmfs/software.eessi.io}`
+
+func TestCheckKeys(t *testing.T) {
+	var keyTests = []struct {
+		name, config string
+		want         []string
+	}{
+		{"valid", `
+image: docker://ghcr.io/eessi/build-node:debian12
+fusemounts:
+  - ` + testFuseMount + `
+writeable_repos: [software.eessi.io]
+profile: gpu
+profiles:
+  gpu:
+    nvidia: all
+    bind_paths: [/opt/nvidia]
+`, nil},
+		{"top level typo", "writable_repos: [software.eessi.io]\n",
+			[]string{`unknown key writable_repos, did you mean "writeable_repos"?`}},
+		{"fusemount typo", "fusemount:\n  - " + testFuseMount + "\n",
+			[]string{`unknown key fusemount, did you mean "fusemounts"?`}},
+		{"fusemounts entry", "fusemounts:\n  - " + testFuseMount + "\n  - {type: container, fusecmd: cvmfs2}\n",
+			[]string{`unknown key fusemounts[1].fusecmd, did you mean "fuse_cmd"?`}},
+		{"profile", "profiles:\n  gpu:\n    bindpaths: [/opt]\n",
+			[]string{`unknown key profiles.gpu.bindpaths, did you mean "bind_paths"?`}},
+		{"profile fusemounts entry", "profiles:\n  gpu:\n    fusemounts:\n      - {fuse_args: a}\n",
+			[]string{`unknown key profiles.gpu.fusemounts[0].fuse_args, did you mean "fuse_arg"?`}},
+		{"profile in a profile", "profiles:\n  gpu:\n    profile: cpu\n  cpu: {}\n",
+			[]string{"profiles.gpu.profile: a profile cannot select another profile"}},
+		{"profiles of a profile", "profiles:\n  gpu:\n    profiles: {}\n",
+			[]string{"unknown key profiles.gpu.profiles"}},
+		{"no close key", "nvidia_mode: all\n",
+			[]string{"unknown key nvidia_mode"}},
+		{"several", "imgae: x\nfusemount: []\n",
+			[]string{`unknown key fusemount, did you mean "fusemounts"?`, `unknown key imgae, did you mean "image"?`}},
+	}
+	for _, tt := range keyTests {
+		var settings map[string]any
+		if err := yaml.Unmarshal([]byte(tt.config), &settings); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		errs := checkKeys(settings)
+		if len(errs) != len(tt.want) {
+			t.Errorf("%s: checkKeys got %v, want %d errors", tt.name, errs, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if !strings.Contains(errs[i].Error(), want) {
+				t.Errorf("%s: checkKeys got %q, want %q", tt.name, errs[i], want)
+			}
+		}
+	}
+}
+
+func TestYamlStringHook(t *testing.T) {
+	to := reflect.TypeOf([]isamctr.FuseMount{})
+	got, err := yamlStringHook(reflect.TypeOf(""), to, "["+testFuseMount+"]")
+	if err != nil {
+		t.Fatalf("yamlStringHook: %s", err)
+	}
+	if list, ok := got.([]any); !ok || len(list) != 1 {
+		t.Errorf("yamlStringHook got %v, want a list of one fusemount", got)
+	}
+
+	var badTests = []struct {
+		in, want string
+	}{
+		{"[{type: container, fusecmd: cvmfs2}]", `unknown key [0].fusecmd, did you mean "fuse_cmd"?`},
+		{"[{type: container}, {ctr_mount: /cvmfs}]", `unknown key [1].ctr_mount, did you mean "ctr_mountpoint"?`},
+		{"[{type: container", "decoding"},
+	}
+	for _, tt := range badTests {
+		_, err := yamlStringHook(reflect.TypeOf(""), to, tt.in)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("yamlStringHook(%s) got %v, want %q", tt.in, err, tt.want)
+		}
+	}
+
+	// other values are passed on
+	if got, err := yamlStringHook(reflect.TypeOf(""), reflect.TypeOf([]string{}), "a,b"); err != nil || got != "a,b" {
+		t.Errorf("yamlStringHook of a string list got %v, %v", got, err)
+	}
+}
+
+// loadTestConfig loads the config file p like samctr does with the
+// environment env and the command line args
+func loadTestConfig(t *testing.T, p string, env map[string]string, args []string) *Config {
+	t.Helper()
+	t.Setenv(EnvName("system_config_dir"), t.TempDir())
+	for _, k := range []string{"image", "host_injections", "root_tmp_dir_prefix", "bind_paths", "writeable_repos", "resume", "extra_bind_paths"} {
+		t.Setenv(EnvName(k), "")
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	viper.Reset()
+	AppConfig = &Config{}
+	root := &cobra.Command{Use: "samctr"}
+	registerFlags(root)
+	if err := root.PersistentFlags().Parse(args); err != nil {
+		t.Fatalf("parsing %v: %s", args, err)
+	}
+	if err := LoadConfig(p, root); err != nil {
+		t.Fatalf("LoadConfig: %s", err)
+	}
+	return AppConfig
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.yaml")
+	config := `
+image: docker://file
+host_injections: /file/host_injections
+bind_paths: [/file]
+fusemounts:
+  - ` + testFuseMount + "\n"
+	if err := os.WriteFile(p, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{
+		"SAMCTR_IMAGE":               "docker://env",
+		"SAMCTR_HOST_INJECTIONS":     "/env/host_injections",
+		"SAMCTR_ROOT_TMP_DIR_PREFIX": "env.",
+		"SAMCTR_BIND_PATHS":          "/env/a,/env/b:/b",
+		"SAMCTR_WRITEABLE_REPOS":     "software.eessi.io,software.asc.ac.at",
+		"SAMCTR_RESUME":              "/env/resume",
+		"SAMCTR_EXTRA_BIND_PATHS":    "/env/extra",
+	}
+	flags := []string{
+		"--image=docker://flag",
+		"--host-injections=/flag/host_injections",
+		"--root-tmp-dir-prefix=flag.",
+		"--writeable-repositories=software.eessi.io",
+		"--resume=/flag/resume",
+		"--extra-bind-paths=/flag/extra",
+	}
+	type values struct {
+		image, hostInjections, prefix string
+		bindPaths, writeableRepos     []string
+		resume, extraBindPaths        string
+	}
+	var precedenceTests = []struct {
+		name string
+		env  map[string]string
+		args []string
+		want values
+	}{
+		{"file and default", nil, nil, values{
+			"docker://file", "/file/host_injections", "sam.",
+			[]string{"/file"}, nil, "", "",
+		}},
+		{"env over file", env, nil, values{
+			"docker://env", "/env/host_injections", "env.",
+			[]string{"/env/a", "/env/b:/b"}, []string{"software.eessi.io", "software.asc.ac.at"}, "/env/resume", "/env/extra",
+		}},
+		{"flag over env", env, flags, values{
+			"docker://flag", "/flag/host_injections", "flag.",
+			[]string{"/env/a", "/env/b:/b"}, []string{"software.eessi.io"}, "/flag/resume", "/flag/extra",
+		}},
+	}
+	for _, tt := range precedenceTests {
+		c := loadTestConfig(t, p, tt.env, tt.args)
+		got := values{
+			c.Image, parseHostInjections(c), c.RootTmpDirPrefix,
+			c.BindPaths, c.WriteableRepos, ResumePath, ExtraBindPaths,
+		}
+		if len(got.writeableRepos) == 0 {
+			got.writeableRepos = nil
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: LoadConfig got\n%+v\nwant\n%+v", tt.name, got, tt.want)
+		}
+	}
+}
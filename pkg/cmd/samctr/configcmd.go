@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+
+	isamctr "github.com/asc-ac-at/sam/internal/samctr"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show and check the configuration",
+	Long: `Show and check the configuration
+
+The configuration is merged from the config files, the selected profile,
+the SAMCTR_* environment variables and the flags, see "samctr config show".`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration with the source of each value",
+	Long: `Print the effective configuration with the source of each value
+
+The source of a value is the flag or environment variable setting it, the
+config file or profile it was taken from, or "default". Entries of
+fusemounts and bind_paths are listed one by one, as they may come from
+different files. An invalid configuration is reported instead, see
+"samctr config validate".
+
+Examples:
+	$ samctr config show
+	$ SAMCTR_PROFILE=gpu samctr config show`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configErr != nil {
+			cmd.SilenceUsage = true
+			return configErr
+		}
+		showConfig(AppConfig)
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate [file]",
+	Short: "Check the configuration without starting a container",
+	Long: `Check the configuration without starting a container
+
+Runs the checks done before every session and further ones: paths on the
+host exist, the fuse commands are known and every writeable repository has
+a fusemount. If a file is given it is used in place of the user config.
+Nothing is pulled or mounted.
+
+Examples:
+	$ samctr config validate
+	$ samctr config validate ~/asc-config.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var problems []error
+		path := cfgFile
+		if len(args) == 1 {
+			path = args[0]
+		}
+		// load again, without the config already merged into viper
+		viper.Reset()
+		AppConfig = &Config{}
+		if err := LoadConfig(path, RootCmd); err != nil {
+			// one problem per unknown key
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				problems = append(problems, joined.Unwrap()...)
+			} else {
+				problems = append(problems, err)
+			}
+		}
+		problems = append(problems, checkConfig(AppConfig)...)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			cmd.SilenceUsage = true
+			return fmt.Errorf("%d configuration problem(s)", len(problems))
+		}
+		fmt.Println("configuration ok")
+		return nil
+	},
+}
+
+// showConfig prints one line per value (per entry for lists) of c
+func showConfig(c *Config) {
+	for _, l := range ConfigLayers {
+		if !strings.HasPrefix(l.Name, "profile ") {
+			fmt.Printf("# config file: %s\n", l.Name)
+		}
+	}
+	settings, _ := ConfigSettings.ApplyProfile(c.Profile)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+	v := reflect.ValueOf(*c)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("mapstructure")
+		if key == "" || key == "-" {
+			continue
+		}
+		source := valueSource(key)
+		f := v.Field(i)
+		if f.Kind() != reflect.Slice {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", key, formatValue(f), source)
+			continue
+		}
+		if f.Len() == 0 {
+			fmt.Fprintf(w, "%s\t[]\t%s\n", key, source)
+			continue
+		}
+		entries, _ := settings[key].([]any)
+		for j := 0; j < f.Len(); j++ {
+			// entries taken from the files are annotated one by one
+			entrySource := source
+			fromFiles := source != "default" && !strings.HasPrefix(source, "flag ") && !strings.HasPrefix(source, "env ")
+			if fromFiles && j < len(entries) {
+				if s := isamctr.EntrySource(ConfigLayers, key, entries[j]); s != "" {
+					entrySource = s
+				}
+			}
+			fmt.Fprintf(w, "%s[%d]\t%s\t%s\n", key, j, formatValue(f.Index(j)), entrySource)
+		}
+	}
+	w.Flush()
+}
+
+// valueSource returns where the value of key comes from: "flag --<name>",
+// "env SAMCTR_<KEY>", a config file, "profile <name>" or "default"
+func valueSource(key string) string {
+	var flag *pflag.Flag
+	RootCmd.PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if FlagKey(f.Name) == key {
+			flag = f
+		}
+	})
+	if flag != nil && flag.Changed {
+		return "flag --" + flag.Name
+	}
+	if os.Getenv(EnvName(key)) != "" {
+		return "env " + EnvName(key)
+	}
+	if source := isamctr.Source(ConfigLayers, key); source != "" {
+		return source
+	}
+	return "default"
+}
+
+// formatValue formats structs like fusemounts as a YAML flow mapping
+func formatValue(v reflect.Value) string {
+	if v.Kind() != reflect.Struct {
+		return fmt.Sprint(v.Interface())
+	}
+	var fields []string
+	for i := 0; i < v.NumField(); i++ {
+		if key := v.Type().Field(i).Tag.Get("mapstructure"); key != "" {
+			fields = append(fields, fmt.Sprintf("%s: %v", key, v.Field(i).Interface()))
+		}
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+func init() {
+	configCmd.AddCommand(configShowCmd)
+	configCmd.AddCommand(configValidateCmd)
+	RootCmd.AddCommand(configCmd)
+}
@@ -15,6 +15,7 @@ var (
 	Image                 string
 	ExtraBindPaths        string
 	Nvidia                string
+	Profile               string
 	ResumePath            string
 	RootTmpDirPrefix      string
 	ToStdout              bool
@@ -24,10 +25,11 @@ var (
 const DefaultHostInjections = "/opt/eessi"
 
 func registerFlags(root *cobra.Command) {
-	root.PersistentFlags().StringVarP(&cfgFile, "config", "f", "", "Config file")
+	root.PersistentFlags().StringVarP(&cfgFile, "config", "f", "", "Config file (env SAMCTR_CONFIG)")
 	root.PersistentFlags().StringVarP(&Image, "image", "c", "", "Container image to use in the buildenv")
 	root.PersistentFlags().StringVarP(&ExtraBindPaths, "extra-bind-paths", "b", "", "Extra bind mounts to pass to apptainer")
 	root.PersistentFlags().StringVarP(&HostInjections, "host-injections", "i", DefaultHostInjections, "Valid path to EESSI's host injections")
+	root.PersistentFlags().StringVar(&Profile, "profile", "", "Profile of the config file to use")
 	root.PersistentFlags().StringVarP(&ResumePath, "resume", "r", "", "Resume path for the container")
 	root.PersistentFlags().StringVarP(&RootTmpDirPrefix, "root-tmp-dir-prefix", "p", "sam.", "Prefix to use for the root tmp directory on host")
 	root.PersistentFlags().StringVarP(&Nvidia, "nvidia", "n", "all", "Enable container for use with Nvidia gpu")
@@ -66,14 +66,11 @@ func PrepareFuseMounts(config *Config) ([]isamctr.FuseMount, error) {
 	return result, nil
 }
 
-// parse config for host injections,
+// parse config for host injections, the flag and env var are already merged
+// into the config by LoadConfig
 func parseHostInjections(c *Config) string {
-	result := ""
-	if HostInjections != DefaultHostInjections { // user specified a flag
-		result = HostInjections
-	} else if c.HostInjections != "" { // check config
-		result = c.HostInjections
-	} else { // use default
+	result := c.HostInjections
+	if result == "" { // use default
 		result = DefaultHostInjections
 	}
 	log.Printf("parse host injections: %s\n", result)
@@ -85,6 +82,9 @@ var apptainerCmdOpts []string
 // Intended to be used as a cobra PreRunE for subcommands that require the
 // container SIF to be available
 func PrepareContainerPreRun(cmd *cobra.Command, args []string) error {
+	if configErr != nil {
+		return configErr
+	}
 
 	// setup fusemounts (try config, then optional --writeable-repository flag)
 	fm, fm_err := PrepareFuseMounts(AppConfig)
@@ -98,7 +98,7 @@ func PrepareContainerPreRun(cmd *cobra.Command, args []string) error {
 	rootTmpDir := ResumePath
 	// if rootTmpDir is "", then use the following prefix to create a random
 	// dir during the flow of SetupStorage
-	rootTmpDirPrefix := RootTmpDirPrefix
+	rootTmpDirPrefix := AppConfig.RootTmpDirPrefix
 
 	// Prepare options for SetupStorage (note: we intentionally do not write back to AppConfig)
 	opts := isamctr.StorageOptions{
@@ -180,10 +180,7 @@ func PrepareContainerPreRun(cmd *cobra.Command, args []string) error {
 	}
 
 	// 8) setup container
-	image := Image
-	if image == "" {
-		image = AppConfig.Image
-	}
+	image := AppConfig.Image
 	if image == "" {
 		return fmt.Errorf("no container image specified (flag or config)")
 	}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// profilesCmd represents the profiles command
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List the profiles of the config file",
+	Long: `List the profiles of the config file
+
+A profile is a named set of settings in the profiles section of the config
+file, merged into the rest of the file when it is selected with --profile or
+SAMCTR_PROFILE. Values of the profile replace those of the file, except for
+fusemounts (entries are matched by fuse_arg) and bind_paths, which are
+extended. The selected profile is marked with a "*".
+
+Examples:
+	$ samctr profiles
+	$ samctr --profile gpu exec -- nvidia-smi`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := ConfigSettings.Profiles()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PROFILE\tSETS")
+		for _, name := range ConfigSettings.ProfileNames() {
+			var keys []string
+			for k := range profiles[name] {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			mark := ""
+			if name == AppConfig.Profile {
+				mark = " *"
+			}
+			fmt.Fprintf(w, "%s%s\t%s\n", name, mark, strings.Join(keys, ","))
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(profilesCmd)
+}
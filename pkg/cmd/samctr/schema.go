@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: GPL-2.0
+/*
+    (c) 2025 Adam McCartney <adam@mur.at>
+*/
+package samctr
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+
+	"github.com/spf13/cobra"
+
+	isamctr "github.com/asc-ac-at/sam/internal/samctr"
+)
+
+// descriptions of the config keys in the JSON Schema
+var configDescriptions = map[string]string{
+	"apptainer_var_home":     "APPTAINER_HOME of the session",
+	"apptainer_var_cachedir": "APPTAINER_CACHEDIR of the session",
+	"root_tmp_dir_prefix":    "prefix of the temporary directory created for the session",
+	"bind_paths":             "bind mounts, <host>[:<container>[:ro|rw]]",
+	"nvidia":                 "use of the Nvidia gpu of the host",
+	"host_injections":        "EESSI host_injections dir on the host",
+	"image":                  "container image, e.g. docker://ghcr.io/eessi/build-node:debian12",
+	"fusemounts":             "fusemounts of the cvmfs repositories",
+	"fuse_cmd_rw":            "fuse implementation of the writeable overlay",
+	"writeable_repos":        "repositories mounted with a writeable overlay, each needs a fusemount",
+	"profile":                "profile selected unless --profile or SAMCTR_PROFILE is given",
+	"type":                   "apptainer fusemount type",
+	"fuse_cmd":               "fuse command mounting the repository",
+	"fuse_arg":               "repository, e.g. software.eessi.io",
+	"ctr_mountpoint":         "mountpoint in the container",
+}
+
+// allowed values of the config keys
+var configEnums = map[string][]string{
+	"nvidia":      {"all"},
+	"fuse_cmd_rw": fuseCmds[1:],
+	"type":        fuseMountTypes,
+	"fuse_cmd":    fuseCmds,
+}
+
+// ConfigSchema returns a JSON Schema of the config file
+func ConfigSchema() map[string]any {
+	settings := schemaOf(reflect.TypeOf(Config{}))
+	profile := schemaOf(reflect.TypeOf(Config{}))
+	// a profile cannot select another profile
+	delete(profile["properties"].(map[string]any), "profile")
+	settings["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	settings["title"] = "samctr config"
+	settings["$defs"] = map[string]any{"profile": profile}
+	settings["properties"].(map[string]any)["profiles"] = map[string]any{
+		"description":          "named profiles merged into the config with --profile or SAMCTR_PROFILE",
+		"type":                 "object",
+		"additionalProperties": map[string]any{"$ref": "#/$defs/profile"},
+	}
+	return settings
+}
+
+// schemaOf returns the schema of the mapstructure fields of t
+func schemaOf(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		for i := 0; i < t.NumField(); i++ {
+			key := t.Field(i).Tag.Get("mapstructure")
+			if key == "" || key == "-" {
+				continue
+			}
+			p := schemaOf(t.Field(i).Type)
+			if d, ok := configDescriptions[key]; ok {
+				p["description"] = d
+			}
+			if e, ok := configEnums[key]; ok {
+				p["enum"] = e
+			}
+			properties[key] = p
+		}
+		s := map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if t == reflect.TypeOf(isamctr.FuseMount{}) {
+			// see validateRequiredConfig
+			s["required"] = []string{"type", "fuse_cmd", "fuse_arg", "ctr_mountpoint"}
+		}
+		return s
+	default:
+		return map[string]any{"type": "string"}
+	}
+}
+
+var configSchemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema of the config file",
+	Long: `Print the JSON Schema of the config file
+
+Editors can validate config files against it, e.g. with the YAML language
+server by adding a comment to the file:
+
+	# yaml-language-server: $schema=/etc/samctr/config.schema.json
+
+Examples:
+	$ samctr config schema >/etc/samctr/config.schema.json`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ConfigSchema())
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configSchemaCmd)
+}